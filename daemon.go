@@ -0,0 +1,176 @@
+package libipvs
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+// SyncDaemon describes an IPVS connection synchronisation daemon.
+type SyncDaemon struct {
+	State              string `json:"state"` // "master" or "backup"
+	MulticastInterface string `json:"mcastifn"`
+	SyncID             int    `json:"syncid"`
+	SyncMaxLen         int    `json:"syncmaxlen"`
+	MulticastGroup     string `json:"mcastgroup"` // IPv4 or IPv6 address
+	MulticastPort      int    `json:"mcastport"`
+	MulticastTTL       int    `json:"mcastttl"`
+}
+
+func parseSyncState(state string) (uint32, error) {
+	switch strings.ToLower(state) {
+	case "master":
+		return IP_VS_STATE_MASTER, nil
+	case "backup":
+		return IP_VS_STATE_BACKUP, nil
+	}
+	return 0, fmt.Errorf("not support sync daemon state %s", state)
+}
+
+func (d *SyncDaemon) Serialize() (nl.NetlinkRequestData, error) {
+	state, err := parseSyncState(d.State)
+	if err != nil {
+		return nil, err
+	}
+
+	cmdAttrDaemon := nl.NewRtAttr(IPVS_CMD_ATTR_DAEMON, nil)
+	nl.NewRtAttrChild(cmdAttrDaemon, IPVS_DAEMON_ATTR_STATE, nl.Uint32Attr(state))
+	nl.NewRtAttrChild(cmdAttrDaemon, IPVS_DAEMON_ATTR_MCAST_IFN, nl.ZeroTerminated(d.MulticastInterface))
+	nl.NewRtAttrChild(cmdAttrDaemon, IPVS_DAEMON_ATTR_SYNC_ID, nl.Uint32Attr(uint32(d.SyncID)))
+
+	if d.SyncMaxLen != 0 {
+		nl.NewRtAttrChild(cmdAttrDaemon, IPVS_DAEMON_ATTR_SYNC_MAXLEN, nl.Uint16Attr(uint16(d.SyncMaxLen)))
+	}
+	if d.MulticastGroup != "" {
+		ip := net.ParseIP(d.MulticastGroup)
+		if ip == nil || !ip.IsMulticast() {
+			return nil, fmt.Errorf("invalid multicast group %s", d.MulticastGroup)
+		}
+		if ip.To4() != nil {
+			nl.NewRtAttrChild(cmdAttrDaemon, IPVS_DAEMON_ATTR_MCAST_GROUP, ip.To4())
+		} else {
+			nl.NewRtAttrChild(cmdAttrDaemon, IPVS_DAEMON_ATTR_MCAST_GROUP6, ip)
+		}
+	}
+	if d.MulticastPort != 0 {
+		// unlike the service and destination ports this one is in host order
+		nl.NewRtAttrChild(cmdAttrDaemon, IPVS_DAEMON_ATTR_MCAST_PORT, nl.Uint16Attr(uint16(d.MulticastPort)))
+	}
+	if d.MulticastTTL != 0 {
+		nl.NewRtAttrChild(cmdAttrDaemon, IPVS_DAEMON_ATTR_MCAST_TTL, nl.Uint8Attr(uint8(d.MulticastTTL)))
+	}
+	return cmdAttrDaemon, nil
+}
+
+func assembleSyncDaemon(attrs []syscall.NetlinkRouteAttr) (*SyncDaemon, error) {
+	var d SyncDaemon
+
+	for _, attr := range attrs {
+		attrType := int(attr.Attr.Type)
+
+		switch attrType {
+		case IPVS_DAEMON_ATTR_STATE:
+			switch native.Uint32(attr.Value) {
+			case IP_VS_STATE_MASTER:
+				d.State = "master"
+			case IP_VS_STATE_BACKUP:
+				d.State = "backup"
+			default:
+				return nil, fmt.Errorf("not support sync daemon state %v", native.Uint32(attr.Value))
+			}
+		case IPVS_DAEMON_ATTR_MCAST_IFN:
+			d.MulticastInterface = nl.BytesToString(attr.Value)
+		case IPVS_DAEMON_ATTR_SYNC_ID:
+			d.SyncID = int(native.Uint32(attr.Value))
+		case IPVS_DAEMON_ATTR_SYNC_MAXLEN:
+			d.SyncMaxLen = int(native.Uint16(attr.Value))
+		case IPVS_DAEMON_ATTR_MCAST_GROUP:
+			d.MulticastGroup = (net.IP)(attr.Value[:4]).String()
+		case IPVS_DAEMON_ATTR_MCAST_GROUP6:
+			d.MulticastGroup = (net.IP)(attr.Value[:16]).String()
+		case IPVS_DAEMON_ATTR_MCAST_PORT:
+			d.MulticastPort = int(native.Uint16(attr.Value))
+		case IPVS_DAEMON_ATTR_MCAST_TTL:
+			d.MulticastTTL = int(attr.Value[0])
+		}
+	}
+	return &d, nil
+}
+
+func (h *IPVSHandler) sendDaemonRequest(ctx context.Context, cmd uint8, d *SyncDaemon) ([][]byte, error) {
+	flags := syscall.NLM_F_ACK
+	var data []nl.NetlinkRequestData
+
+	switch cmd {
+	case IPVS_CMD_GET_DAEMON:
+		flags |= syscall.NLM_F_DUMP
+	case IPVS_CMD_NEW_DAEMON, IPVS_CMD_DEL_DAEMON:
+		daemonAttr, err := d.Serialize()
+		if err != nil {
+			return nil, invalidArgument(cmd, nil, nil, err)
+		}
+		data = append(data, daemonAttr)
+	}
+
+	resp, err := h.request(ctx, cmd, flags, data...)
+	if err != nil {
+		return nil, wrapError(cmd, nil, nil, err)
+	}
+	return resp, nil
+}
+
+// StartSyncDaemon starts a master or backup connection synchronisation daemon.
+func (h *IPVSHandler) StartSyncDaemon(d *SyncDaemon) error {
+	return h.StartSyncDaemonContext(context.Background(), d)
+}
+
+func (h *IPVSHandler) StartSyncDaemonContext(ctx context.Context, d *SyncDaemon) error {
+	_, err := h.sendDaemonRequest(ctx, IPVS_CMD_NEW_DAEMON, d)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// StopSyncDaemon stops the daemon running in state, "master" or "backup".
+func (h *IPVSHandler) StopSyncDaemon(state string) error {
+	return h.StopSyncDaemonContext(context.Background(), state)
+}
+
+func (h *IPVSHandler) StopSyncDaemonContext(ctx context.Context, state string) error {
+	_, err := h.sendDaemonRequest(ctx, IPVS_CMD_DEL_DAEMON, &SyncDaemon{State: state})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetSyncDaemons returns the running sync daemons.
+func (h *IPVSHandler) GetSyncDaemons() ([]*SyncDaemon, error) {
+	return h.GetSyncDaemonsContext(context.Background())
+}
+
+func (h *IPVSHandler) GetSyncDaemonsContext(ctx context.Context) ([]*SyncDaemon, error) {
+	msgs, err := h.sendDaemonRequest(ctx, IPVS_CMD_GET_DAEMON, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ipvsAttrs, err := h.parseGenlHeaders(msgs)
+	if err != nil {
+		return nil, err
+	}
+	var daemons []*SyncDaemon
+	for _, attrs := range ipvsAttrs {
+		d, err := assembleSyncDaemon(attrs)
+		if err != nil {
+			return nil, err
+		}
+		daemons = append(daemons, d)
+	}
+	return daemons, nil
+}
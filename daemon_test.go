@@ -0,0 +1,61 @@
+package libipvs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+func TestSyncDaemonSerialize(t *testing.T) {
+	daemons := []*SyncDaemon{
+		{State: "master", MulticastInterface: "eth0", SyncID: 10},
+		{State: "backup", MulticastInterface: "eth1", SyncID: 20, SyncMaxLen: 1472,
+			MulticastGroup: "224.0.0.81", MulticastPort: 8848, MulticastTTL: 2},
+		{State: "master", MulticastInterface: "eth0", MulticastGroup: "ff02::1:81"},
+	}
+	for _, d := range daemons {
+		attr, err := d.Serialize()
+		if err != nil {
+			t.Fatalf("Failed serialize sync daemon %s", err)
+		}
+		attrs, err := nl.ParseRouteAttr(attr.Serialize()[syscall.SizeofRtAttr:])
+		if err != nil {
+			t.Fatalf("Failed parse sync daemon %s", err)
+		}
+		got, err := assembleSyncDaemon(attrs)
+		if err != nil {
+			t.Fatalf("Failed assemble sync daemon %s", err)
+		}
+		if *got != *d {
+			t.Errorf("different sync daemon %+v, expected %+v", got, d)
+		}
+	}
+
+	// the kernel reads the multicast port in host byte order
+	attr, err := (&SyncDaemon{State: "master", MulticastInterface: "eth0", MulticastPort: 8848}).Serialize()
+	if err != nil {
+		t.Fatalf("Failed serialize sync daemon %s", err)
+	}
+	attrs, err := nl.ParseRouteAttr(attr.Serialize()[syscall.SizeofRtAttr:])
+	if err != nil {
+		t.Fatalf("Failed parse sync daemon %s", err)
+	}
+	for _, a := range attrs {
+		if int(a.Attr.Type) == IPVS_DAEMON_ATTR_MCAST_PORT {
+			want := []byte{0x22, 0x90} // 8848
+			if native == binary.LittleEndian {
+				want = []byte{0x90, 0x22}
+			}
+			if !bytes.Equal(a.Value, want) {
+				t.Errorf("different multicast port bytes %v, expected %v", a.Value, want)
+			}
+		}
+	}
+
+	if _, err := (&SyncDaemon{State: "none"}).Serialize(); err == nil {
+		t.Errorf("invalid state accepted")
+	}
+}
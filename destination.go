@@ -0,0 +1,53 @@
+package libipvs
+
+import (
+	"fmt"
+)
+
+// DestinationOption sets optional attributes of a destination when it is
+// added or updated.
+type DestinationOption func(*DestinationEntry) error
+
+// WithUpperThreshold stops sending new connections to the destination while
+// it has n or more connections. Zero means no limit.
+func WithUpperThreshold(n int) DestinationOption {
+	return func(d *DestinationEntry) error {
+		if n < 0 {
+			return fmt.Errorf("invalid upper threshold %d", n)
+		}
+		d.UpperThreshold = n
+		return nil
+	}
+}
+
+// WithLowerThreshold resumes sending connections to an overloaded
+// destination once it has fewer than n connections. Zero means three
+// quarters of the upper threshold.
+func WithLowerThreshold(n int) DestinationOption {
+	return func(d *DestinationEntry) error {
+		if n < 0 {
+			return fmt.Errorf("invalid lower threshold %d", n)
+		}
+		d.LowerThreshold = n
+		return nil
+	}
+}
+
+func (d *DestinationEntry) apply(opts []DestinationOption) error {
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DestinationEntry) validateThresholds() error {
+	if d.UpperThreshold < 0 || d.LowerThreshold < 0 {
+		return fmt.Errorf("invalid thresholds %d/%d", d.UpperThreshold, d.LowerThreshold)
+	}
+	if d.UpperThreshold != 0 && d.LowerThreshold > d.UpperThreshold {
+		return fmt.Errorf("lower threshold %d above upper threshold %d", d.LowerThreshold, d.UpperThreshold)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package libipvs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DrainProgress is reported while a destination is drained.
+type DrainProgress struct {
+	Service             ServiceKey
+	Destination         DestinationKey
+	ActiveConnections   uint32
+	InActiveConnections uint32
+	PersistConnections  uint32
+	Elapsed             time.Duration
+	Done                bool
+}
+
+// Connections returns the number of connections left on the destination.
+func (p DrainProgress) Connections() uint64 {
+	return uint64(p.ActiveConnections) + uint64(p.InActiveConnections) + uint64(p.PersistConnections)
+}
+
+type drainConfig struct {
+	threshold uint64
+	interval  time.Duration
+	timeout   time.Duration
+	progress  func(DrainProgress)
+	delete    bool
+}
+
+// DrainOption configures DrainDestination.
+type DrainOption func(*drainConfig)
+
+// WithDrainThreshold considers the destination drained once it has at most
+// n connections, active, inactive and persistence templates together.
+// The default is 0.
+func WithDrainThreshold(n uint64) DrainOption {
+	return func(c *drainConfig) {
+		c.threshold = n
+	}
+}
+
+// WithDrainInterval sets how often the connections are polled, one second
+// by default.
+func WithDrainInterval(d time.Duration) DrainOption {
+	return func(c *drainConfig) {
+		c.interval = d
+	}
+}
+
+// WithDrainTimeout gives up draining after d. Without it draining lasts
+// until the context is done.
+func WithDrainTimeout(d time.Duration) DrainOption {
+	return func(c *drainConfig) {
+		c.timeout = d
+	}
+}
+
+// WithDrainProgress calls fn after each poll of the connections. fn is
+// called from the draining goroutine and should not block.
+func WithDrainProgress(fn func(DrainProgress)) DrainOption {
+	return func(c *drainConfig) {
+		c.progress = fn
+	}
+}
+
+// WithDrainDelete deletes the destination once it is drained.
+func WithDrainDelete() DrainOption {
+	return func(c *drainConfig) {
+		c.delete = true
+	}
+}
+
+// DrainDestination sets the weight of the destination dkey of the service
+// key to 0, so that it gets no new connections, and waits until its
+// connections fall to the drain threshold. Persistent clients keep using
+// the destination until their templates expire. If the deadline passes
+// first the returned error matches context.DeadlineExceeded and the
+// destination is left with weight 0. A destination deleted meanwhile is
+// reported as drained.
+func (h *IPVSHandler) DrainDestination(key ServiceKey, dkey DestinationKey, opts ...DrainOption) error {
+	return h.DrainDestinationContext(context.Background(), key, dkey, opts...)
+}
+
+func (h *IPVSHandler) DrainDestinationContext(ctx context.Context, key ServiceKey, dkey DestinationKey, opts ...DrainOption) error {
+	c := drainConfig{interval: time.Second}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.interval <= 0 {
+		return fmt.Errorf("invalid drain interval %v", c.interval)
+	}
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	weight := 0
+	if err := h.PatchDestinationContext(ctx, key, dkey, DestinationPatch{Weight: &weight}); err != nil {
+		return drainError(ctx, key, dkey, nil, err)
+	}
+	si, err := h.getService(ctx, key)
+	if err != nil {
+		return drainError(ctx, key, dkey, nil, err)
+	}
+
+	var d *DestinationEntry
+	var last *DrainProgress
+	start := time.Now()
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		d, err = h.GetDestinationContext(ctx, si, dkey.Address, dkey.Port)
+		if errors.Is(err, ErrDestinationNotFound) {
+			// removed by someone else, nothing left to drain
+			if c.progress != nil {
+				c.progress(DrainProgress{Service: key, Destination: dkey, Elapsed: time.Since(start), Done: true})
+			}
+			return nil
+		}
+		if err != nil {
+			return drainError(ctx, key, dkey, last, err)
+		}
+
+		p := DrainProgress{
+			Service:             key,
+			Destination:         dkey,
+			ActiveConnections:   d.ActiveConnections,
+			InActiveConnections: d.InActiveConnections,
+			PersistConnections:  d.PersistConnections,
+			Elapsed:             time.Since(start),
+		}
+		p.Done = p.Connections() <= c.threshold
+		if c.progress != nil {
+			c.progress(p)
+		}
+		if p.Done {
+			break
+		}
+		last = &p
+
+		select {
+		case <-ctx.Done():
+			return drainError(ctx, key, dkey, last, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	if c.delete {
+		_, err := h.sendRequest(ctx, IPVS_CMD_DEL_DEST, si, d)
+		return drainError(ctx, key, dkey, nil, err)
+	}
+	return nil
+}
+
+// drainError adds the destination and the connections left at the last
+// poll p, if any, to err when it comes from the end of ctx. Other errors
+// are returned unchanged.
+func drainError(ctx context.Context, key ServiceKey, dkey DestinationKey, p *DrainProgress, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("drain %s of %s: %w", dkey, key, err)
+	}
+	return fmt.Errorf("drain %s of %s: %d connections left: %w", dkey, key, p.Connections(), err)
+}
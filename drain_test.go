@@ -0,0 +1,74 @@
+package libipvs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrainDestination(t *testing.T) {
+	ipvsHandler, err := NewIPVSHandler()
+	if err != nil {
+		t.Fatalf("Failed create IPVSHandler %s", err)
+	}
+
+	key := ServiceKey{Address: "127.1.1.2", Port: 8888, Protocol: "TCP"}
+	dkey := DestinationKey{Address: "127.2.1.1", Port: 8888}
+
+	err = ipvsHandler.AddService(key.Address, key.Port, key.Protocol, "wlc")
+	if err != nil {
+		t.Fatalf("Failed add service %s", err)
+	}
+	defer ipvsHandler.DeleteService(key.Address, key.Port, key.Protocol)
+
+	si, err := ipvsHandler.GetService(key.Address, key.Port, key.Protocol)
+	if err != nil {
+		t.Fatalf("Failed get service %s", err)
+	}
+	err = ipvsHandler.AddDestination(si, dkey.Address, dkey.Port, 100, "DR", WithUpperThreshold(50))
+	if err != nil {
+		t.Fatalf("Failed add destination %s", err)
+	}
+
+	var reports []DrainProgress
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = ipvsHandler.DrainDestinationContext(ctx, key, dkey,
+		WithDrainInterval(10*time.Millisecond),
+		WithDrainProgress(func(p DrainProgress) { reports = append(reports, p) }),
+		WithDrainDelete())
+	if err != nil {
+		t.Fatalf("Failed drain destination %s", err)
+	}
+	if len(reports) == 0 || !reports[len(reports)-1].Done {
+		t.Errorf("Failed report drain progress %+v", reports)
+	}
+
+	destinations, err := ipvsHandler.GetDestinations(si)
+	if err != nil {
+		t.Fatalf("Failed get destinations %s", err)
+	}
+	if len(destinations) != 0 {
+		t.Errorf("Failed delete drained destination %+v", destinations)
+	}
+}
+
+func TestDrainError(t *testing.T) {
+	key := ServiceKey{Address: "127.1.1.2", Port: 8888, Protocol: "TCP"}
+	dkey := DestinationKey{Address: "127.2.1.1", Port: 8888}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	other := errors.New("other")
+	if err := drainError(ctx, key, dkey, nil, other); err != other {
+		t.Errorf("Expected unchanged error, got %v", err)
+	}
+	cancel()
+	for _, p := range []*DrainProgress{nil, {ActiveConnections: 3}} {
+		err := drainError(ctx, key, dkey, p, ctx.Err())
+		if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "drain "+dkey.String()+" of "+key.String()) {
+			t.Errorf("different drain error %v", err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package libipvs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// ErrIPVSUnavailable is matched (with errors.Is) by the error NewIPVSHandler
+// returns when the kernel IPVS subsystem cannot be used.
+var ErrIPVSUnavailable = errors.New("ipvs unavailable")
+
+// UnavailableReason tells why the IPVS subsystem could not be reached.
+type UnavailableReason int
+
+const (
+	ReasonNetlinkUnavailable UnavailableReason = iota + 1 // generic netlink socket could not be used
+	ReasonModuleNotLoaded                                 // the ip_vs module is not loaded
+	ReasonPermissionDenied                                // missing CAP_NET_ADMIN
+)
+
+func (r UnavailableReason) String() string {
+	switch r {
+	case ReasonNetlinkUnavailable:
+		return "generic netlink unavailable"
+	case ReasonModuleNotLoaded:
+		return "ip_vs module not loaded"
+	case ReasonPermissionDenied:
+		return "permission denied"
+	}
+	return fmt.Sprintf("unknown reason %d", int(r))
+}
+
+// UnavailableError is returned by NewIPVSHandler when IPVS cannot be used.
+type UnavailableError struct {
+	Reason UnavailableReason
+	Err    error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("ipvs unavailable: %s: %v", e.Reason, e.Err)
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrIPVSUnavailable
+}
+
+func newUnavailableError(err error, fallback UnavailableReason) error {
+	reason := fallback
+	var errno syscall.Errno
+	errors.As(err, &errno)
+	switch errno {
+	case syscall.EPERM, syscall.EACCES:
+		reason = ReasonPermissionDenied
+	case syscall.EPROTONOSUPPORT, syscall.EAFNOSUPPORT:
+		reason = ReasonNetlinkUnavailable
+	}
+	return &UnavailableError{Reason: reason, Err: err}
+}
+
+// Errors matched (with errors.Is) by an *OperationError.
+var (
+	ErrServiceExists       = errors.New("service already exists")
+	ErrServiceNotFound     = errors.New("service not found")
+	ErrDestinationExists   = errors.New("destination already exists")
+	ErrDestinationNotFound = errors.New("destination not found")
+	ErrSchedulerNotFound   = errors.New("scheduler or persistence engine not found")
+	ErrInvalidArgument     = errors.New("invalid argument")
+	ErrNotSupported        = errors.New("not supported by the running kernel")
+)
+
+var cmdNames = map[uint8]string{
+	IPVS_CMD_NEW_SERVICE: "NEW_SERVICE",
+	IPVS_CMD_SET_SERVICE: "SET_SERVICE",
+	IPVS_CMD_DEL_SERVICE: "DEL_SERVICE",
+	IPVS_CMD_GET_SERVICE: "GET_SERVICE",
+	IPVS_CMD_NEW_DEST:    "NEW_DEST",
+	IPVS_CMD_SET_DEST:    "SET_DEST",
+	IPVS_CMD_DEL_DEST:    "DEL_DEST",
+	IPVS_CMD_GET_DEST:    "GET_DEST",
+	IPVS_CMD_NEW_DAEMON:  "NEW_DAEMON",
+	IPVS_CMD_DEL_DAEMON:  "DEL_DAEMON",
+	IPVS_CMD_GET_DAEMON:  "GET_DAEMON",
+	IPVS_CMD_SET_TIMEOUT: "SET_TIMEOUT",
+	IPVS_CMD_GET_TIMEOUT: "GET_TIMEOUT",
+	IPVS_CMD_GET_INFO:    "GET_INFO",
+	IPVS_CMD_ZERO:        "ZERO",
+	IPVS_CMD_FLUSH:       "FLUSH",
+}
+
+// OperationError describes a failed IPVS command. Err is one of the sentinel
+// errors above when the failure could be classified, Errno is the errno
+// returned by the kernel or 0 if the request never reached it. Message and
+// Attribute carry the kernel's extended ACK, if any: the reason of the
+// failure and the name of the offending attribute.
+type OperationError struct {
+	Op          string
+	Service     *ServiceKey
+	Destination *DestinationKey
+	Err         error
+	Errno       syscall.Errno
+	Message     string
+	Attribute   string
+
+	applied bool // the change stayed in the kernel despite the error
+}
+
+func (e *OperationError) Error() string {
+	msg := "ipvs " + e.Op
+	if e.Service != nil {
+		msg += " " + e.Service.String()
+	}
+	if e.Destination != nil {
+		msg += " -> " + e.Destination.String()
+	}
+	switch {
+	case e.Err != nil && e.Errno != 0:
+		msg += fmt.Sprintf(": %v (%v)", e.Err, e.Errno)
+	case e.Err != nil:
+		msg += fmt.Sprintf(": %v", e.Err)
+	case e.Errno != 0:
+		msg += fmt.Sprintf(": %v", e.Errno)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Attribute != "" {
+		msg += " (" + e.Attribute + ")"
+	}
+	return msg
+}
+
+func (e *OperationError) Unwrap() error {
+	if e.Err != nil {
+		return e.Err
+	}
+	if e.Errno != 0 {
+		return e.Errno
+	}
+	return nil
+}
+
+// Is matches the errno returned by the kernel, so that errors.Is finds both
+// the sentinel error and the errno.
+func (e *OperationError) Is(target error) bool {
+	errno, ok := target.(syscall.Errno)
+	return ok && e.Errno != 0 && errno == e.Errno
+}
+
+// As fills a *syscall.Errno target with the errno returned by the kernel,
+// which Unwrap hides behind the sentinel error.
+func (e *OperationError) As(target interface{}) bool {
+	errno, ok := target.(*syscall.Errno)
+	if !ok || e.Errno == 0 {
+		return false
+	}
+	*errno = e.Errno
+	return true
+}
+
+func newOperationError(cmd uint8, si *ServiceEntry, di *DestinationEntry, err error) *OperationError {
+	oe := &OperationError{Op: cmdNames[cmd]}
+	if si != nil {
+		key := si.Key()
+		oe.Service = &key
+	}
+	if di != nil {
+		key := di.Key()
+		oe.Destination = &key
+	}
+
+	if nerr, ok := err.(*netlinkError); ok {
+		oe.Message = nerr.Message
+		oe.Attribute = nerr.Attribute
+		err = nerr.Errno
+	}
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		oe.Err = err
+		return oe
+	}
+	oe.Errno = errno
+
+	switch errno {
+	case syscall.EEXIST:
+		switch cmd {
+		case IPVS_CMD_NEW_SERVICE:
+			oe.Err = ErrServiceExists
+		case IPVS_CMD_NEW_DEST:
+			oe.Err = ErrDestinationExists
+		}
+	case syscall.ESRCH:
+		oe.Err = ErrServiceNotFound
+	case syscall.ENOENT:
+		switch cmd {
+		case IPVS_CMD_NEW_SERVICE, IPVS_CMD_SET_SERVICE:
+			oe.Err = ErrSchedulerNotFound
+		case IPVS_CMD_SET_DEST, IPVS_CMD_DEL_DEST:
+			oe.Err = ErrDestinationNotFound
+		}
+	case syscall.EINVAL:
+		oe.Err = ErrInvalidArgument
+	}
+	return oe
+}
+
+// wrapError turns an error of a request into an *OperationError. Context
+// errors are returned unchanged.
+func wrapError(cmd uint8, si *ServiceEntry, di *DestinationEntry, err error) error {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+	return newOperationError(cmd, si, di, err)
+}
+
+// invalidArgument wraps a validation failure detected before talking to the
+// kernel.
+func invalidArgument(cmd uint8, si *ServiceEntry, di *DestinationEntry, err error) *OperationError {
+	oe := newOperationError(cmd, si, di, ErrInvalidArgument)
+	oe.Message = err.Error()
+	return oe
+}
+
+func notSupported(cmd uint8, si *ServiceEntry, di *DestinationEntry, err error) *OperationError {
+	oe := newOperationError(cmd, si, di, ErrNotSupported)
+	oe.Message = err.Error()
+	return oe
+}
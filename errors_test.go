@@ -0,0 +1,66 @@
+package libipvs
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+func TestUnavailableError(t *testing.T) {
+	tests := []struct {
+		err    error
+		reason UnavailableReason
+	}{
+		{syscall.ENOENT, ReasonModuleNotLoaded},
+		{syscall.EPERM, ReasonPermissionDenied},
+		{syscall.EPROTONOSUPPORT, ReasonNetlinkUnavailable},
+	}
+	for _, test := range tests {
+		err := newUnavailableError(test.err, ReasonModuleNotLoaded)
+		if !errors.Is(err, ErrIPVSUnavailable) {
+			t.Errorf("%v does not match ErrIPVSUnavailable", err)
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("%v does not wrap %v", err, test.err)
+		}
+		var uerr *UnavailableError
+		if !errors.As(err, &uerr) || uerr.Reason != test.reason {
+			t.Errorf("different reason for %v: %v", test.err, err)
+		}
+	}
+}
+
+func TestOperationError(t *testing.T) {
+	si := &ServiceEntry{Address: "127.1.1.1", Protocol: "TCP", Port: 8888}
+	di := &DestinationEntry{Address: "127.2.1.1", Port: 8888}
+
+	tests := []struct {
+		cmd    uint8
+		di     *DestinationEntry
+		errno  syscall.Errno
+		target error
+	}{
+		{IPVS_CMD_NEW_SERVICE, nil, syscall.EEXIST, ErrServiceExists},
+		{IPVS_CMD_DEL_SERVICE, nil, syscall.ESRCH, ErrServiceNotFound},
+		{IPVS_CMD_SET_SERVICE, nil, syscall.ENOENT, ErrSchedulerNotFound},
+		{IPVS_CMD_NEW_DEST, di, syscall.EEXIST, ErrDestinationExists},
+		{IPVS_CMD_DEL_DEST, di, syscall.ENOENT, ErrDestinationNotFound},
+		{IPVS_CMD_NEW_DEST, di, syscall.EINVAL, ErrInvalidArgument},
+	}
+	for _, test := range tests {
+		err := newOperationError(test.cmd, si, test.di, test.errno)
+		if !errors.Is(err, test.target) {
+			t.Errorf("%v does not match %v", err, test.target)
+		}
+		if !errors.Is(err, test.errno) {
+			t.Errorf("%v does not match %v", err, test.errno)
+		}
+		var errno syscall.Errno
+		if !errors.As(err, &errno) || errno != test.errno {
+			t.Errorf("%v gives errno %v, want %v", err, errno, test.errno)
+		}
+		if *err.Service != si.Key() {
+			t.Errorf("different service key %v", err.Service)
+		}
+	}
+}
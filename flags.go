@@ -0,0 +1,134 @@
+package libipvs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ServiceFlags is the set of IP_VS_SVC_F_* flags of a virtual service.
+type ServiceFlags uint32
+
+const (
+	ServiceFlagPersistent ServiceFlags = IP_VS_SVC_F_PERSISTENT
+	ServiceFlagHashed     ServiceFlags = IP_VS_SVC_F_HASHED
+	ServiceFlagOnePacket  ServiceFlags = IP_VS_SVC_F_ONEPACKET
+	ServiceFlagSched1     ServiceFlags = IP_VS_SVC_F_SCHED1
+	ServiceFlagSched2     ServiceFlags = IP_VS_SVC_F_SCHED2
+	ServiceFlagSched3     ServiceFlags = IP_VS_SVC_F_SCHED3
+
+	// The scheduler flags mean different things to each scheduler.
+	ServiceFlagSHFallback = ServiceFlagSched1 // sh: fallback to another server if unavailable
+	ServiceFlagSHPort     = ServiceFlagSched2 // sh: hash the source port too
+	ServiceFlagMHFallback = ServiceFlagSched1 // mh: fallback to another server if unavailable
+	ServiceFlagMHPort     = ServiceFlagSched2 // mh: hash the source port too
+)
+
+var serviceFlagNames = []struct {
+	flag ServiceFlags
+	name string
+}{
+	{ServiceFlagPersistent, "persistent"},
+	{ServiceFlagHashed, "hashed"},
+	{ServiceFlagOnePacket, "ops"},
+	{ServiceFlagSched1, "flag-1"},
+	{ServiceFlagSched2, "flag-2"},
+	{ServiceFlagSched3, "flag-3"},
+}
+
+var schedFlagNames = map[string]map[ServiceFlags]string{
+	"sh": {ServiceFlagSHFallback: "sh-fallback", ServiceFlagSHPort: "sh-port"},
+	"mh": {ServiceFlagMHFallback: "mh-fallback", ServiceFlagMHPort: "mh-port"},
+}
+
+// String returns the comma separated names of the flags, naming the
+// scheduler flags "flag-1", "flag-2" and "flag-3".
+func (f ServiceFlags) String() string {
+	return f.Format("")
+}
+
+// Format is like String but uses the names the scheduler schedName gives to
+// the scheduler flags, e.g. "sh-port".
+func (f ServiceFlags) Format(schedName string) string {
+	var names []string
+	for _, n := range serviceFlagNames {
+		if f&n.flag == 0 {
+			continue
+		}
+		name := n.name
+		if schedName, ok := schedFlagNames[schedName][n.flag]; ok {
+			name = schedName
+		}
+		names = append(names, name)
+		f &^= n.flag
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("0x%x", uint32(f)))
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseServiceFlags parses a comma separated list of flag names as written
+// by String and Format, e.g. "persistent,ops,sh-port".
+func ParseServiceFlags(s string) (ServiceFlags, error) {
+	var f ServiceFlags
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		flag, ok := lookupServiceFlag(name)
+		if !ok {
+			return 0, fmt.Errorf("not support service flag %s", name)
+		}
+		f |= flag
+	}
+	return f, nil
+}
+
+func lookupServiceFlag(name string) (ServiceFlags, bool) {
+	for _, n := range serviceFlagNames {
+		if n.name == name {
+			return n.flag, true
+		}
+	}
+	for _, names := range schedFlagNames {
+		for flag, n := range names {
+			if n == name {
+				return flag, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// SetFlags sets f. Once SetFlags or ClearFlags has been used only the flags
+// they changed are sent to the kernel, the others keep their current value.
+func (s *ServiceEntry) SetFlags(f ServiceFlags) {
+	s.Flags |= f
+	s.flagsMask |= f
+	s.maskFlags = true
+}
+
+// ClearFlags clears f, see SetFlags.
+func (s *ServiceEntry) ClearFlags(f ServiceFlags) {
+	s.Flags &^= f
+	s.flagsMask |= f
+	s.maskFlags = true
+}
+
+// WithFlags sets flags on the service. Flags named neither by WithFlags nor
+// WithoutFlags keep their current value when a service is updated.
+func WithFlags(f ServiceFlags) ServiceOption {
+	return func(s *ServiceEntry) error {
+		s.SetFlags(f)
+		return nil
+	}
+}
+
+// WithoutFlags clears flags on the service.
+func WithoutFlags(f ServiceFlags) ServiceOption {
+	return func(s *ServiceEntry) error {
+		s.ClearFlags(f)
+		return nil
+	}
+}
@@ -0,0 +1,91 @@
+package libipvs
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+func TestServiceFlags(t *testing.T) {
+	f, err := ParseServiceFlags("persistent,ops,sh-port")
+	if err != nil {
+		t.Fatalf("Failed parse service flags %s", err)
+	}
+	if f != ServiceFlagPersistent|ServiceFlagOnePacket|ServiceFlagSHPort {
+		t.Errorf("different flags 0x%x", uint32(f))
+	}
+	if f.String() != "persistent,ops,flag-2" {
+		t.Errorf("different string %s", f.String())
+	}
+	if f.Format("sh") != "persistent,ops,sh-port" {
+		t.Errorf("different format %s", f.Format("sh"))
+	}
+	if f.Format("mh") != "persistent,ops,mh-port" {
+		t.Errorf("different format %s", f.Format("mh"))
+	}
+	if _, err := ParseServiceFlags("persistent,sticky"); err == nil {
+		t.Errorf("invalid flag accepted")
+	}
+}
+
+func TestServiceFlagsMask(t *testing.T) {
+	s := &ServiceEntry{Flags: ServiceFlagOnePacket}
+	if s.flagsMask != 0 {
+		t.Errorf("different mask 0x%x", uint32(s.flagsMask))
+	}
+	s.SetFlags(ServiceFlagSHFallback)
+	s.ClearFlags(ServiceFlagOnePacket)
+	if s.Flags != ServiceFlagSHFallback {
+		t.Errorf("different flags %s", s.Flags)
+	}
+	if s.flagsMask != ServiceFlagSHFallback|ServiceFlagOnePacket {
+		t.Errorf("different mask %s", s.flagsMask)
+	}
+}
+
+func serviceFlagsAttr(t *testing.T, s *ServiceEntry) (flags, mask uint32) {
+	attr, err := s.Serialize()
+	if err != nil {
+		t.Fatalf("Failed serialize service %s", err)
+	}
+	attrs, err := nl.ParseRouteAttr(attr.Serialize()[syscall.SizeofRtAttr:])
+	if err != nil {
+		t.Fatalf("Failed parse service %s", err)
+	}
+	for _, a := range attrs {
+		if int(a.Attr.Type) == IPVS_SVC_ATTR_FLAGS {
+			return native.Uint32(a.Value[:4]), native.Uint32(a.Value[4:])
+		}
+	}
+	t.Fatalf("no IPVS_SVC_ATTR_FLAGS")
+	return 0, 0
+}
+
+func TestServiceOptionsFlagsMask(t *testing.T) {
+	// as built by UpdateService
+	s := &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, SchedName: "sh"}
+	if err := s.apply([]ServiceOption{WithFlags(ServiceFlagSHPort)}); err != nil {
+		t.Fatalf("Failed apply option %s", err)
+	}
+	flags, mask := serviceFlagsAttr(t, s)
+	if flags != IP_VS_SVC_F_SCHED2 || mask != IP_VS_SVC_F_SCHED2|IP_VS_SVC_F_PERSISTENT {
+		t.Errorf("different flags 0x%x/0x%x", flags, mask)
+	}
+
+	s = &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, SchedName: "sh"}
+	if err := s.apply([]ServiceOption{WithPersistence(300 * time.Second), WithoutFlags(ServiceFlagOnePacket)}); err != nil {
+		t.Fatalf("Failed apply option %s", err)
+	}
+	flags, mask = serviceFlagsAttr(t, s)
+	if flags != IP_VS_SVC_F_PERSISTENT || mask != IP_VS_SVC_F_PERSISTENT|IP_VS_SVC_F_ONEPACKET {
+		t.Errorf("different flags 0x%x/0x%x", flags, mask)
+	}
+
+	// entries without SetFlags, ClearFlags or options send all flags
+	s = &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, SchedName: "sh", Flags: ServiceFlagOnePacket}
+	if flags, mask = serviceFlagsAttr(t, s); flags != IP_VS_SVC_F_ONEPACKET || mask != 0xFFFFFFFF {
+		t.Errorf("different flags 0x%x/0x%x", flags, mask)
+	}
+}
@@ -0,0 +1,78 @@
+package libipvs
+
+import (
+	"context"
+)
+
+// AddFWMarkService adds a service matching the packets marked fwmark by
+// netfilter instead of an address, port and protocol. family selects the
+// address family of the service, "IPv4" or "IPv6"; an empty family means
+// "IPv4". Destinations are managed with AddDestination and UpdateDestination
+// on the entry returned by GetFWMarkService.
+func (h *IPVSHandler) AddFWMarkService(fwmark int, family string, schedName string, opts ...ServiceOption) error {
+	return h.AddFWMarkServiceContext(context.Background(), fwmark, family, schedName, opts...)
+}
+
+func (h *IPVSHandler) AddFWMarkServiceContext(ctx context.Context, fwmark int, family string, schedName string, opts ...ServiceOption) error {
+	cmd := IPVS_CMD_NEW_SERVICE
+	si := &ServiceEntry{FWMark: fwmark, AddressFamily: family, SchedName: schedName}
+	if err := si.apply(opts); err != nil {
+		return invalidArgument(cmd, si, nil, err)
+	}
+
+	_, err := h.sendRequest(ctx, cmd, si, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (h *IPVSHandler) UpdateFWMarkService(fwmark int, family string, schedName string, opts ...ServiceOption) error {
+	return h.UpdateFWMarkServiceContext(context.Background(), fwmark, family, schedName, opts...)
+}
+
+func (h *IPVSHandler) UpdateFWMarkServiceContext(ctx context.Context, fwmark int, family string, schedName string, opts ...ServiceOption) error {
+	cmd := IPVS_CMD_SET_SERVICE
+	si := &ServiceEntry{FWMark: fwmark, AddressFamily: family, SchedName: schedName}
+	if err := si.apply(opts); err != nil {
+		return invalidArgument(cmd, si, nil, err)
+	}
+
+	_, err := h.sendRequest(ctx, cmd, si, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (h *IPVSHandler) GetFWMarkService(fwmark int, family string) (*ServiceEntry, error) {
+	return h.GetFWMarkServiceContext(context.Background(), fwmark, family)
+}
+
+func (h *IPVSHandler) GetFWMarkServiceContext(ctx context.Context, fwmark int, family string) (*ServiceEntry, error) {
+	return h.getService(ctx, ServiceKey{FWMark: fwmark, AddressFamily: family})
+}
+
+func (h *IPVSHandler) IsRegisteredFWMarkService(fwmark int, family string) (bool, error) {
+	return h.IsRegisteredFWMarkServiceContext(context.Background(), fwmark, family)
+}
+
+func (h *IPVSHandler) IsRegisteredFWMarkServiceContext(ctx context.Context, fwmark int, family string) (bool, error) {
+	return h.isRegisteredService(ctx, ServiceKey{FWMark: fwmark, AddressFamily: family})
+}
+
+func (h *IPVSHandler) DeleteFWMarkService(fwmark int, family string) error {
+	return h.DeleteFWMarkServiceContext(context.Background(), fwmark, family)
+}
+
+func (h *IPVSHandler) DeleteFWMarkServiceContext(ctx context.Context, fwmark int, family string) error {
+	return h.deleteService(ctx, ServiceKey{FWMark: fwmark, AddressFamily: family})
+}
+
+func (h *IPVSHandler) DeleteFWMarkDestination(fwmark int, family string, rip string, rport int) error {
+	return h.DeleteFWMarkDestinationContext(context.Background(), fwmark, family, rip, rport)
+}
+
+func (h *IPVSHandler) DeleteFWMarkDestinationContext(ctx context.Context, fwmark int, family string, rip string, rport int) error {
+	return h.deleteDestination(ctx, ServiceKey{FWMark: fwmark, AddressFamily: family}, rip, rport)
+}
@@ -1,90 +1,253 @@
 package libipvs
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"os/exec"
+	"sync"
 	"syscall"
+	"time"
 
-	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
 )
 
 var (
 	native = nl.NativeEndian()
 )
 
+// IPVSHandler owns a generic netlink socket to the kernel IPVS subsystem.
+// It is safe for concurrent use by multiple goroutines; requests sharing the
+// socket are serialized.
+//
+// Every method has a Context variant. The context bounds the time spent
+// waiting for the socket and for the kernel replies; a cancelled dump is
+// aborted and returns ctx.Err().
 type IPVSHandler struct {
-	familyID int
+	familyID   int
+	rcvBufSize int
+	autoload   bool
+	schedCheck bool
+
+	lock       chan struct{}
+	sock       *nl.NetlinkSocket
+	rcvTimeout time.Duration
+	pid        uint32
+	seq        uint32
+	dumpSeq    uint32
+	rbuf       []byte
+
+	tunnelSupport int32 // tunnel attributes known to the kernel, see verifyTunnel
+
+	schedLock  sync.Mutex
+	schedulers map[string]bool // cached AvailableSchedulers, see checkScheduler
 }
 
-func NewIPVSHandler() (*IPVSHandler, error) {
-	ipvs := &IPVSHandler{}
-	ipvs.getIPVSFamilyID()
+// HandlerOption configures an IPVSHandler at construction time.
+type HandlerOption func(*IPVSHandler)
+
+// WithReceiveBufferSize sets SO_RCVBUF on the handler socket. Large values
+// help when dumping many services or destinations.
+func WithReceiveBufferSize(size int) HandlerOption {
+	return func(h *IPVSHandler) {
+		h.rcvBufSize = size
+	}
+}
+
+// WithModuleAutoload makes the constructor run "modprobe ip_vs" when the IPVS
+// generic netlink family is not registered yet. With WithSchedulerCheck the
+// modules of unknown schedulers are loaded too.
+func WithModuleAutoload() HandlerOption {
+	return func(h *IPVSHandler) {
+		h.autoload = true
+	}
+}
+
+// WithSchedulerCheck makes the handler check the scheduler of the services
+// it adds or updates against AvailableSchedulers, read on first use and
+// cached. An unknown scheduler fails with ErrSchedulerNotFound before
+// anything is sent to the kernel.
+func WithSchedulerCheck() HandlerOption {
+	return func(h *IPVSHandler) {
+		h.schedCheck = true
+	}
+}
+
+// NewIPVSHandler returns a handler for the IPVS instance of the current
+// network namespace. If IPVS cannot be used the error matches
+// ErrIPVSUnavailable and is an *UnavailableError.
+func NewIPVSHandler(opts ...HandlerOption) (*IPVSHandler, error) {
+	return NewIPVSHandlerAt(netns.None(), opts...)
+}
+
+// NewIPVSHandlerAt returns a handler bound to the IPVS instance of the network
+// namespace ns. The socket is opened inside ns once, so every later request
+// is served by that namespace without the caller switching threads.
+func NewIPVSHandlerAt(ns netns.NsHandle, opts ...HandlerOption) (*IPVSHandler, error) {
+	ipvs := &IPVSHandler{lock: make(chan struct{}, 1)}
+	for _, opt := range opts {
+		opt(ipvs)
+	}
+	if err := ipvs.openSocket(ns); err != nil {
+		return nil, newUnavailableError(err, ReasonNetlinkUnavailable)
+	}
+	if err := ipvs.init(); err != nil {
+		ipvs.Close()
+		return nil, err
+	}
 	return ipvs, nil
 }
 
+// init resolves the IPVS family and checks that we are allowed to use it.
+func (h *IPVSHandler) init() error {
+	err := h.getIPVSFamilyID()
+	if errors.Is(err, syscall.ENOENT) && h.autoload {
+		if err := loadModule("ip_vs"); err != nil {
+			return &UnavailableError{Reason: ReasonModuleNotLoaded, Err: err}
+		}
+		err = h.getIPVSFamilyID()
+	}
+	if err != nil {
+		return newUnavailableError(err, ReasonModuleNotLoaded)
+	}
+
+	// Every IPVS command requires CAP_NET_ADMIN, the family lookup does not.
+	req := nl.NewNetlinkRequest(h.familyID, 0)
+	req.AddData(&nl.Genlmsg{Command: IPVS_CMD_GET_INFO, Version: 1})
+	if _, err := h.execute(context.Background(), req); err != nil {
+		return newUnavailableError(err, ReasonNetlinkUnavailable)
+	}
+	return nil
+}
+
+func loadModule(name string) error {
+	out, err := exec.Command("modprobe", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("modprobe %s: %v: %s", name, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
 func (h *IPVSHandler) getIPVSFamilyID() error {
-	var err error
-	ipvsFamily, err := netlink.GenlFamilyGet("IPVS")
+	req := nl.NewNetlinkRequest(nl.GENL_ID_CTRL, 0)
+	req.AddData(&nl.Genlmsg{Command: nl.GENL_CTRL_CMD_GETFAMILY, Version: nl.GENL_CTRL_VERSION})
+	req.AddData(nl.NewRtAttr(nl.GENL_CTRL_ATTR_FAMILY_NAME, nl.ZeroTerminated("IPVS")))
+
+	msgs, err := h.execute(context.Background(), req)
 	if err != nil {
 		return err
 	}
-	h.familyID = int(ipvsFamily.ID)
-	return nil
+	for _, msg := range msgs {
+		attrs, err := nl.ParseRouteAttr(msg[nl.SizeofGenlmsg:])
+		if err != nil {
+			return err
+		}
+		for _, attr := range attrs {
+			if attr.Attr.Type == nl.GENL_CTRL_ATTR_FAMILY_ID {
+				h.familyID = int(native.Uint16(attr.Value))
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("invalid response for GENL_CTRL_CMD_GETFAMILY")
 }
 
-func (h *IPVSHandler) sendRequest(cmd uint8, si *ServiceEntry, di *DestinationEntry) ([][]byte, error) {
+func (h *IPVSHandler) sendRequest(ctx context.Context, cmd uint8, si *ServiceEntry, di *DestinationEntry) ([][]byte, error) {
 	var err error
+	var data []nl.NetlinkRequestData
 	var serviceAttr nl.NetlinkRequestData
 	var destinationAttr nl.NetlinkRequestData
 
-	req := nl.NewNetlinkRequest(int(h.familyID), syscall.NLM_F_ACK)
-	req.AddData(&nl.Genlmsg{Command: cmd, Version: 1})
+	flags := syscall.NLM_F_ACK
 
 	if si != nil {
 		serviceAttr, err = si.Serialize()
 		if err != nil {
-			return nil, err
+			return nil, invalidArgument(cmd, si, di, err)
 		}
 	}
 
 	if di != nil {
 		destinationAttr, err = di.Serialize()
 		if err != nil {
-			return nil, err
+			return nil, invalidArgument(cmd, si, di, err)
 		}
 	}
 
 	switch cmd {
 	case IPVS_CMD_FLUSH:
+	case IPVS_CMD_ZERO:
+		if si != nil {
+			data = append(data, serviceAttr)
+		}
 	case IPVS_CMD_GET_SERVICE:
-		req.Flags |= syscall.NLM_F_DUMP
+		if si == nil {
+			flags |= syscall.NLM_F_DUMP
+		} else {
+			data = append(data, serviceAttr)
+		}
 	case IPVS_CMD_GET_DEST:
-		req.Flags |= syscall.NLM_F_DUMP
-		req.AddData(serviceAttr)
-	case IPVS_CMD_NEW_SERVICE:
-		req.AddData(serviceAttr)
-	case IPVS_CMD_SET_SERVICE:
-		req.AddData(serviceAttr)
+		flags |= syscall.NLM_F_DUMP
+		data = append(data, serviceAttr)
+	case IPVS_CMD_NEW_SERVICE, IPVS_CMD_SET_SERVICE:
+		af, _ := si.family()
+		if err := si.validatePersistence(af); err != nil {
+			return nil, invalidArgument(cmd, si, di, err)
+		}
+		if err := h.checkScheduler(cmd, si); err != nil {
+			return nil, err
+		}
+		data = append(data, serviceAttr)
 	case IPVS_CMD_DEL_SERVICE:
-		req.AddData(serviceAttr)
-	case IPVS_CMD_NEW_DEST:
-		req.AddData(serviceAttr)
-		req.AddData(destinationAttr)
-	case IPVS_CMD_SET_DEST:
-		req.AddData(serviceAttr)
-		req.AddData(destinationAttr)
+		data = append(data, serviceAttr)
+	case IPVS_CMD_NEW_DEST, IPVS_CMD_SET_DEST:
+		if err := di.validateFamily(si); err != nil {
+			return nil, invalidArgument(cmd, si, di, err)
+		}
+		if err := h.checkTunnel(cmd, si, di); err != nil {
+			return nil, err
+		}
+		data = append(data, serviceAttr, destinationAttr)
 	case IPVS_CMD_DEL_DEST:
-		req.AddData(serviceAttr)
-		req.AddData(destinationAttr)
+		data = append(data, serviceAttr, destinationAttr)
 	}
 
-	resp, err := req.Execute(syscall.NETLINK_GENERIC, 0)
+	verify := (cmd == IPVS_CMD_NEW_DEST || cmd == IPVS_CMD_SET_DEST) && h.mustVerifyTunnel(di)
+	var old *DestinationEntry
+	if verify && cmd == IPVS_CMD_SET_DEST {
+		// keep the current entry to restore it if the kernel ignores the
+		// tunnel attributes
+		if old, err = h.GetDestinationContext(ctx, si, di.Address, di.Port); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := h.request(ctx, cmd, flags, data...)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(cmd, si, di, err)
+	}
+
+	if verify {
+		if err := h.verifyTunnel(ctx, cmd, si, di, old); err != nil {
+			return nil, err
+		}
 	}
 	return resp, nil
 }
 
+// request sends the IPVS command cmd carrying data as first level attributes.
+func (h *IPVSHandler) request(ctx context.Context, cmd uint8, flags int, data ...nl.NetlinkRequestData) ([][]byte, error) {
+	req := nl.NewNetlinkRequest(h.familyID, flags)
+	req.AddData(&nl.Genlmsg{Command: cmd, Version: 1})
+	for _, d := range data {
+		req.AddData(d)
+	}
+	return h.execute(ctx, req)
+}
+
 func (h *IPVSHandler) parseIPVSServiceMessage(attrs [][]syscall.NetlinkRouteAttr) ([]*ServiceEntry, error) {
 	var services []*ServiceEntry
 	for _, ipvsAttrs := range attrs {
@@ -97,10 +260,10 @@ func (h *IPVSHandler) parseIPVSServiceMessage(attrs [][]syscall.NetlinkRouteAttr
 	return services, nil
 }
 
-func (h *IPVSHandler) parseIPVSDestinationMessage(attrs [][]syscall.NetlinkRouteAttr) ([]*DestinationEntry, error) {
+func (h *IPVSHandler) parseIPVSDestinationMessage(attrs [][]syscall.NetlinkRouteAttr, af uint16) ([]*DestinationEntry, error) {
 	var destinations []*DestinationEntry
 	for _, ipvsAttrs := range attrs {
-		d, err := assembleDestinationInterface(ipvsAttrs)
+		d, err := assembleDestinationInterface(ipvsAttrs, af)
 		if err != nil {
 			return nil, err
 		}
@@ -130,15 +293,22 @@ func (h *IPVSHandler) parseGenlHeaders(msgs [][]byte) ([][]syscall.NetlinkRouteA
 }
 
 func (h *IPVSHandler) GetAllEntry() ([]*Entry, error) {
+	return h.GetAllEntryContext(context.Background())
+}
+
+func (h *IPVSHandler) GetAllEntryContext(ctx context.Context) ([]*Entry, error) {
 	var err error
 	var entries []*Entry
-	services, err := h.GetServices()
+	services, err := h.GetServicesContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, s := range services {
-		d, err := h.GetDestinations(s)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		d, err := h.GetDestinationsContext(ctx, s)
 		if err != nil {
 			return nil, err
 		}
@@ -149,32 +319,36 @@ func (h *IPVSHandler) GetAllEntry() ([]*Entry, error) {
 }
 
 func (h *IPVSHandler) IsRegisteredService(vip string, port int, protocol string) (bool, error) {
-	cmd := IPVS_CMD_GET_SERVICE
-	si := &ServiceEntry{Address: vip, Protocol: protocol, Port: port}
+	return h.IsRegisteredServiceContext(context.Background(), vip, port, protocol)
+}
 
-	msgs, err := h.sendRequest(cmd, si, nil)
-	if err != nil {
-		return false, err
-	}
+func (h *IPVSHandler) IsRegisteredServiceContext(ctx context.Context, vip string, port int, protocol string) (bool, error) {
+	return h.isRegisteredService(ctx, ServiceKey{Address: vip, Port: port, Protocol: protocol})
+}
 
-	ipvsAttrs, err := h.parseGenlHeaders(msgs)
-	if err != nil {
-		return false, err
+func (h *IPVSHandler) isRegisteredService(ctx context.Context, key ServiceKey) (bool, error) {
+	_, err := h.getService(ctx, key)
+	if errors.Is(err, ErrServiceNotFound) {
+		return false, nil
 	}
-	services, err := h.parseIPVSServiceMessage(ipvsAttrs)
 	if err != nil {
 		return false, err
 	}
-	if len(services) < 1 {
-		return false, nil
-	}
 	return true, nil
 }
 
 func (h *IPVSHandler) GetService(vip string, port int, protocol string) (*ServiceEntry, error) {
+	return h.GetServiceContext(context.Background(), vip, port, protocol)
+}
+
+func (h *IPVSHandler) GetServiceContext(ctx context.Context, vip string, port int, protocol string) (*ServiceEntry, error) {
+	return h.getService(ctx, ServiceKey{Address: vip, Port: port, Protocol: protocol})
+}
+
+func (h *IPVSHandler) getService(ctx context.Context, key ServiceKey) (*ServiceEntry, error) {
 	cmd := IPVS_CMD_GET_SERVICE
-	si := &ServiceEntry{Address: vip, Protocol: protocol, Port: port}
-	msgs, err := h.sendRequest(cmd, si, nil)
+	si := key.entry()
+	msgs, err := h.sendRequest(ctx, cmd, si, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -187,18 +361,20 @@ func (h *IPVSHandler) GetService(vip string, port int, protocol string) (*Servic
 	if err != nil {
 		return nil, err
 	}
-	if len(services) < 1 {
-		return nil, fmt.Errorf("not found entry %v", services)
-	} else if len(services) > 1 {
-		return nil, fmt.Errorf("found duplicate entry %v", services)
+	if len(services) != 1 {
+		return nil, newOperationError(cmd, si, nil, ErrServiceNotFound)
 	}
 	return services[0], nil
 }
 
 func (h *IPVSHandler) GetServices() ([]*ServiceEntry, error) {
+	return h.GetServicesContext(context.Background())
+}
+
+func (h *IPVSHandler) GetServicesContext(ctx context.Context) ([]*ServiceEntry, error) {
 	var err error
 	cmd := IPVS_CMD_GET_SERVICE
-	msgs, err := h.sendRequest(cmd, nil, nil)
+	msgs, err := h.sendRequest(ctx, cmd, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -208,14 +384,27 @@ func (h *IPVSHandler) GetServices() ([]*ServiceEntry, error) {
 		return nil, err
 	}
 	services, err := h.parseIPVSServiceMessage(ipvsAttrs)
+	if err != nil {
+		return nil, err
+	}
 	return services, nil
 }
 
-func (h *IPVSHandler) UpdateService(ip string, port int, protocol string, schedName string) error {
+// UpdateService replaces the scheduler and persistence settings of a service
+// with schedName and opts. Flags not named by WithFlags or WithoutFlags keep
+// their value. Use PatchService to change single attributes.
+func (h *IPVSHandler) UpdateService(ip string, port int, protocol string, schedName string, opts ...ServiceOption) error {
+	return h.UpdateServiceContext(context.Background(), ip, port, protocol, schedName, opts...)
+}
+
+func (h *IPVSHandler) UpdateServiceContext(ctx context.Context, ip string, port int, protocol string, schedName string, opts ...ServiceOption) error {
 	var err error
 	cmd := IPVS_CMD_SET_SERVICE
 	si := &ServiceEntry{Address: ip, Protocol: protocol, Port: port, SchedName: schedName}
-	_, err = h.sendRequest(cmd, si, nil)
+	if err := si.apply(opts); err != nil {
+		return invalidArgument(cmd, si, nil, err)
+	}
+	_, err = h.sendRequest(ctx, cmd, si, nil)
 	if err != nil {
 		return err
 	}
@@ -223,13 +412,21 @@ func (h *IPVSHandler) UpdateService(ip string, port int, protocol string, schedN
 }
 
 func (h *IPVSHandler) DeleteService(vip string, port int, protocol string) error {
+	return h.DeleteServiceContext(context.Background(), vip, port, protocol)
+}
+
+func (h *IPVSHandler) DeleteServiceContext(ctx context.Context, vip string, port int, protocol string) error {
+	return h.deleteService(ctx, ServiceKey{Address: vip, Port: port, Protocol: protocol})
+}
+
+func (h *IPVSHandler) deleteService(ctx context.Context, key ServiceKey) error {
 	cmd := IPVS_CMD_DEL_SERVICE
-	si, err := h.GetService(vip, port, protocol)
+	si, err := h.getService(ctx, key)
 	if err != nil {
 		return err
 	}
 
-	_, err = h.sendRequest(cmd, si, nil)
+	_, err = h.sendRequest(ctx, cmd, si, nil)
 	if err != nil {
 		return err
 	}
@@ -237,81 +434,160 @@ func (h *IPVSHandler) DeleteService(vip string, port int, protocol string) error
 }
 
 func (h *IPVSHandler) Flush() error {
+	return h.FlushContext(context.Background())
+}
+
+func (h *IPVSHandler) FlushContext(ctx context.Context) error {
 	cmd := IPVS_CMD_FLUSH
-	_, err := h.sendRequest(cmd, nil, nil)
+	_, err := h.sendRequest(ctx, cmd, nil, nil)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (h *IPVSHandler) AddService(vip string, port int, protocol string, schedName string) error {
-	var err error
-	cmd := IPVS_CMD_NEW_SERVICE
+// ZeroAll resets the statistics of every service and destination.
+func (h *IPVSHandler) ZeroAll() error {
+	return h.ZeroAllContext(context.Background())
+}
 
-	si := &ServiceEntry{Address: vip, Protocol: protocol, Port: port, SchedName: schedName}
+func (h *IPVSHandler) ZeroAllContext(ctx context.Context) error {
+	cmd := IPVS_CMD_ZERO
+	_, err := h.sendRequest(ctx, cmd, nil, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
 
-	_, err = h.sendRequest(cmd, si, nil)
+// ZeroService resets the statistics of a service and of all its
+// destinations. The kernel has no command to zero a single destination.
+func (h *IPVSHandler) ZeroService(key ServiceKey) error {
+	return h.ZeroServiceContext(context.Background(), key)
+}
+
+func (h *IPVSHandler) ZeroServiceContext(ctx context.Context, key ServiceKey) error {
+	cmd := IPVS_CMD_ZERO
+	_, err := h.sendRequest(ctx, cmd, key.entry(), nil)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (h *IPVSHandler) AddDestination(si *ServiceEntry, ip string, port int, weight int, method string) error {
+// AddService adds a virtual service. opts set optional attributes such as
+// persistence.
+func (h *IPVSHandler) AddService(vip string, port int, protocol string, schedName string, opts ...ServiceOption) error {
+	return h.AddServiceContext(context.Background(), vip, port, protocol, schedName, opts...)
+}
+
+func (h *IPVSHandler) AddServiceContext(ctx context.Context, vip string, port int, protocol string, schedName string, opts ...ServiceOption) error {
 	var err error
-	cmd := IPVS_CMD_NEW_DEST
-	di := &DestinationEntry{Address: ip, Port: port, Weight: weight, Method: method}
+	cmd := IPVS_CMD_NEW_SERVICE
+
+	si := &ServiceEntry{Address: vip, Protocol: protocol, Port: port, SchedName: schedName}
+	if err := si.apply(opts); err != nil {
+		return invalidArgument(cmd, si, nil, err)
+	}
 
-	_, err = h.sendRequest(cmd, si, di)
+	_, err = h.sendRequest(ctx, cmd, si, nil)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (h *IPVSHandler) UpdateDestination(si *ServiceEntry, ip string, port int, weight int, method string) error {
-	var err error
-	cmd := IPVS_CMD_SET_DEST
+// AddDestination adds a destination to the service si. Thresholds and tunnel
+// encapsulation are set with opts.
+func (h *IPVSHandler) AddDestination(si *ServiceEntry, ip string, port int, weight int, method string, opts ...DestinationOption) error {
+	return h.AddDestinationContext(context.Background(), si, ip, port, weight, method, opts...)
+}
+
+func (h *IPVSHandler) AddDestinationContext(ctx context.Context, si *ServiceEntry, ip string, port int, weight int, method string, opts ...DestinationOption) error {
 	di := &DestinationEntry{Address: ip, Port: port, Weight: weight, Method: method}
+	if err := di.apply(opts); err != nil {
+		return invalidArgument(IPVS_CMD_NEW_DEST, si, di, err)
+	}
+	return h.AddDestinationEntryContext(ctx, si, di)
+}
 
-	_, err = h.sendRequest(cmd, si, di)
+// AddDestinationEntry adds the destination di to the service si.
+func (h *IPVSHandler) AddDestinationEntry(si *ServiceEntry, di *DestinationEntry) error {
+	return h.AddDestinationEntryContext(context.Background(), si, di)
+}
+
+func (h *IPVSHandler) AddDestinationEntryContext(ctx context.Context, si *ServiceEntry, di *DestinationEntry) error {
+	_, err := h.sendRequest(ctx, IPVS_CMD_NEW_DEST, si, di)
 	if err != nil {
 		return err
 	}
 	return nil
 }
-func (h *IPVSHandler) GetDestination(si *ServiceEntry, rip string, rport int) (*DestinationEntry, error) {
-	var err error
-	cmd := IPVS_CMD_GET_DEST
-	di := &DestinationEntry{Address: rip, Port: rport}
 
-	msgs, err := h.sendRequest(cmd, si, di)
-	if err != nil {
-		return nil, err
+// UpdateDestination changes the weight and method of a destination of si.
+// Thresholds and tunnel encapsulation are reset unless they are set with
+// opts; PatchDestination keeps them, and so does UpdateDestinationEntry with
+// an entry that carries them, without reading the destination first.
+func (h *IPVSHandler) UpdateDestination(si *ServiceEntry, ip string, port int, weight int, method string, opts ...DestinationOption) error {
+	return h.UpdateDestinationContext(context.Background(), si, ip, port, weight, method, opts...)
+}
+
+func (h *IPVSHandler) UpdateDestinationContext(ctx context.Context, si *ServiceEntry, ip string, port int, weight int, method string, opts ...DestinationOption) error {
+	di := &DestinationEntry{
+		Address: ip,
+		Port:    port,
+		Weight:  weight,
+		Method:  method,
 	}
+	if err := di.apply(opts); err != nil {
+		return invalidArgument(IPVS_CMD_SET_DEST, si, di, err)
+	}
+	return h.UpdateDestinationEntryContext(ctx, si, di)
+}
 
-	ipvsAttrs, err := h.parseGenlHeaders(msgs)
+// UpdateDestinationEntry replaces the settings of a destination of si with
+// the ones of di; unset thresholds and tunnel options are reset.
+func (h *IPVSHandler) UpdateDestinationEntry(si *ServiceEntry, di *DestinationEntry) error {
+	return h.UpdateDestinationEntryContext(context.Background(), si, di)
+}
+
+func (h *IPVSHandler) UpdateDestinationEntryContext(ctx context.Context, si *ServiceEntry, di *DestinationEntry) error {
+	_, err := h.sendRequest(ctx, IPVS_CMD_SET_DEST, si, di)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	destinations, err := h.parseIPVSDestinationMessage(ipvsAttrs)
+	return nil
+}
+
+func (h *IPVSHandler) GetDestination(si *ServiceEntry, rip string, rport int) (*DestinationEntry, error) {
+	return h.GetDestinationContext(context.Background(), si, rip, rport)
+}
+
+func (h *IPVSHandler) GetDestinationContext(ctx context.Context, si *ServiceEntry, rip string, rport int) (*DestinationEntry, error) {
+	di := &DestinationEntry{Address: rip, Port: rport}
+	destinations, err := h.GetDestinationsContext(ctx, si)
 	if err != nil {
 		return nil, err
 	}
-	if len(destinations) < 1 {
-		return nil, fmt.Errorf("Not found destination")
-	} else if len(destinations) > 1 {
-		return nil, fmt.Errorf("found duplication destination")
+
+	ip := net.ParseIP(rip)
+	for _, d := range destinations {
+		if d.Port == rport && ip.Equal(net.ParseIP(d.Address)) {
+			return d, nil
+		}
 	}
-	return destinations[0], nil
+	return nil, newOperationError(IPVS_CMD_GET_DEST, si, di, ErrDestinationNotFound)
 }
 
 func (h *IPVSHandler) GetDestinations(si *ServiceEntry) ([]*DestinationEntry, error) {
+	return h.GetDestinationsContext(context.Background(), si)
+}
+
+func (h *IPVSHandler) GetDestinationsContext(ctx context.Context, si *ServiceEntry) ([]*DestinationEntry, error) {
 	var err error
 	cmd := IPVS_CMD_GET_DEST
 
-	msgs, err := h.sendRequest(cmd, si, nil)
+	msgs, err := h.sendRequest(ctx, cmd, si, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -320,7 +596,8 @@ func (h *IPVSHandler) GetDestinations(si *ServiceEntry) ([]*DestinationEntry, er
 	if err != nil {
 		return nil, err
 	}
-	destinations, err := h.parseIPVSDestinationMessage(ipvsAttrs)
+	af, _ := si.family() // si was serialized by sendRequest
+	destinations, err := h.parseIPVSDestinationMessage(ipvsAttrs, af)
 	if err != nil {
 		return nil, err
 	}
@@ -328,18 +605,25 @@ func (h *IPVSHandler) GetDestinations(si *ServiceEntry) ([]*DestinationEntry, er
 }
 
 func (h *IPVSHandler) DeleteDestination(vip string, vport int, rip string, rport int, protocol string) error {
-	var err error
+	return h.DeleteDestinationContext(context.Background(), vip, vport, rip, rport, protocol)
+}
+
+func (h *IPVSHandler) DeleteDestinationContext(ctx context.Context, vip string, vport int, rip string, rport int, protocol string) error {
+	return h.deleteDestination(ctx, ServiceKey{Address: vip, Port: vport, Protocol: protocol}, rip, rport)
+}
+
+func (h *IPVSHandler) deleteDestination(ctx context.Context, key ServiceKey, rip string, rport int) error {
 	cmd := IPVS_CMD_DEL_DEST
-	si, err := h.GetService(vip, vport, protocol)
+	si, err := h.getService(ctx, key)
 	if err != nil {
 		return err
 	}
 
-	di, err := h.GetDestination(si, rip, rport)
+	di, err := h.GetDestinationContext(ctx, si, rip, rport)
 	if err != nil {
 		return err
 	}
-	_, err = h.sendRequest(cmd, si, di)
+	_, err = h.sendRequest(ctx, cmd, si, di)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,78 @@
+package libipvs
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+// IPVSVersion is the IPVS version reported by the kernel.
+type IPVSVersion struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Patch int `json:"patch"`
+}
+
+func (v IPVSVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether v is major.minor.patch or newer.
+func (v IPVSVersion) AtLeast(major, minor, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+// Info holds the global IPVS information.
+type Info struct {
+	Version       IPVSVersion `json:"version"`
+	ConnTableSize int         `json:"conntablesize"`
+}
+
+func assembleInfo(attrs []syscall.NetlinkRouteAttr) *Info {
+	var i Info
+
+	for _, attr := range attrs {
+		switch int(attr.Attr.Type) {
+		case IPVS_INFO_ATTR_VERSION:
+			v := native.Uint32(attr.Value)
+			i.Version = IPVSVersion{
+				Major: int(v >> 16),
+				Minor: int((v >> 8) & 0xff),
+				Patch: int(v & 0xff),
+			}
+		case IPVS_INFO_ATTR_CONN_TAB_SIZE:
+			i.ConnTableSize = int(native.Uint32(attr.Value))
+		}
+	}
+	return &i
+}
+
+// Info returns the kernel IPVS version and connection table size.
+func (h *IPVSHandler) Info() (*Info, error) {
+	return h.InfoContext(context.Background())
+}
+
+func (h *IPVSHandler) InfoContext(ctx context.Context) (*Info, error) {
+	cmd := IPVS_CMD_GET_INFO
+	msgs, err := h.request(ctx, cmd, syscall.NLM_F_ACK)
+	if err != nil {
+		return nil, wrapError(cmd, nil, nil, err)
+	}
+	if len(msgs) != 1 {
+		return nil, fmt.Errorf("invalid response for IPVS_CMD_GET_INFO")
+	}
+
+	attrs, err := nl.ParseRouteAttr(msgs[0][nl.SizeofGenlmsg:])
+	if err != nil {
+		return nil, err
+	}
+	return assembleInfo(attrs), nil
+}
@@ -0,0 +1,39 @@
+package libipvs
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+func TestAssembleInfo(t *testing.T) {
+	attrs := []syscall.NetlinkRouteAttr{
+		{Attr: syscall.RtAttr{Type: uint16(IPVS_INFO_ATTR_VERSION)}, Value: nl.Uint32Attr(0x010201)},
+		{Attr: syscall.RtAttr{Type: uint16(IPVS_INFO_ATTR_CONN_TAB_SIZE)}, Value: nl.Uint32Attr(4096)},
+	}
+	info := assembleInfo(attrs)
+	if info.Version != (IPVSVersion{Major: 1, Minor: 2, Patch: 1}) || info.Version.String() != "1.2.1" {
+		t.Errorf("different version %s", info.Version)
+	}
+	if info.ConnTableSize != 4096 {
+		t.Errorf("different connection table size %d", info.ConnTableSize)
+	}
+
+	for _, c := range []struct {
+		major, minor, patch int
+		want                bool
+	}{
+		{1, 2, 1, true},
+		{1, 2, 0, true},
+		{1, 1, 9, true},
+		{0, 9, 9, true},
+		{1, 2, 2, false},
+		{1, 3, 0, false},
+		{2, 0, 0, false},
+	} {
+		if got := info.Version.AtLeast(c.major, c.minor, c.patch); got != c.want {
+			t.Errorf("1.2.1 AtLeast(%d, %d, %d) = %v", c.major, c.minor, c.patch, got)
+		}
+	}
+}
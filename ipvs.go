@@ -3,9 +3,10 @@ package libipvs
 import (
 	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 	"syscall"
 	"unsafe"
 
@@ -19,8 +20,8 @@ var (
 )
 
 type Entry struct {
-	Service      *ServiceEntry
-	Destinations []*DestinationEntry
+	Service      *ServiceEntry       `json:"service"`
+	Destinations []*DestinationEntry `json:"destinations"`
 }
 
 type ServiceEntry struct {
@@ -29,42 +30,108 @@ type ServiceEntry struct {
 	Port     int    `json:"port"`
 	FWMark   int    `json:"fwmark"`
 
-	SchedName     string `json:"scheduler"`
-	Flags         int    `json:"flags"`
-	Timeout       int    `json:"timeout"`
-	Netmask       int    `json:"netmask"`
-	AddressFamily string `json:"addressfamily"`
-	PEName        string `json:"pename"`
-	Stats         Stats
+	SchedName     string       `json:"scheduler"`
+	Flags         ServiceFlags `json:"flags"`
+	Timeout       int          `json:"timeout"`
+	Netmask       int          `json:"netmask"`
+	AddressFamily string       `json:"addressfamily"`
+	PEName        string       `json:"pename"`
+	Stats         Stats        `json:"stats"`
+
+	// flagsMask holds the flags changed by SetFlags, ClearFlags and the
+	// service options. Only they are sent once maskFlags is set.
+	flagsMask ServiceFlags
+	maskFlags bool
 }
 
-func (s *ServiceEntry) Serialize() (nl.NetlinkRequestData, error) {
-	ip := net.ParseIP(s.Address)
-	if ip == nil {
-		return nil, fmt.Errorf("invalid IP address %s", s.Address)
+// ServiceKey identifies a virtual service, either by address, port and
+// protocol or by firewall mark and address family ("IPv4" if empty).
+type ServiceKey struct {
+	Address       string `json:"vip,omitempty"`
+	Protocol      string `json:"protocol,omitempty"`
+	Port          int    `json:"port,omitempty"`
+	FWMark        int    `json:"fwmark,omitempty"`
+	AddressFamily string `json:"addressfamily,omitempty"`
+}
+
+func (k ServiceKey) String() string {
+	if k.FWMark != 0 {
+		if k.AddressFamily == "IPv6" {
+			return fmt.Sprintf("fwmark:%d/IPv6", k.FWMark)
+		}
+		return fmt.Sprintf("fwmark:%d", k.FWMark)
 	}
+	return fmt.Sprintf("%s:%s", strings.ToLower(k.Protocol), net.JoinHostPort(k.Address, strconv.Itoa(k.Port)))
+}
 
-	var protocol uint16
-	switch s.Protocol {
-	case "TCP", "tcp", "Tcp":
-		protocol = syscall.IPPROTO_TCP //0x6
-	case "UDP", "udp", "Udp":
-		protocol = syscall.IPPROTO_UDP //0x11
-	case "SCTP", "sctp", "Sctp":
-		protocol = syscall.IPPROTO_SCTP //0x84
-	default:
-		return nil, fmt.Errorf("not support protocol %s", s.Protocol)
+// entry returns a service entry carrying only the key, enough to look the
+// service up in the kernel.
+func (k ServiceKey) entry() *ServiceEntry {
+	return &ServiceEntry{Address: k.Address, Protocol: k.Protocol, Port: k.Port, FWMark: k.FWMark, AddressFamily: k.AddressFamily}
+}
+
+// normalize returns k in the canonical form used by the entries read from
+// the kernel, so that keys can be compared.
+func (k ServiceKey) normalize() ServiceKey {
+	if k.FWMark != 0 {
+		family := "IPv4"
+		if af, err := parseAddressFamily(k.AddressFamily); err == nil && af == syscall.AF_INET6 {
+			family = "IPv6"
+		}
+		return ServiceKey{FWMark: k.FWMark, AddressFamily: family}
 	}
+	address := k.Address
+	if ip := net.ParseIP(k.Address); ip != nil {
+		address = ip.String()
+	}
+	return ServiceKey{Address: address, Protocol: strings.ToUpper(k.Protocol), Port: k.Port}
+}
 
+func (s *ServiceEntry) Key() ServiceKey {
+	k := ServiceKey{Address: s.Address, Protocol: s.Protocol, Port: s.Port}
+	if s.FWMark != 0 {
+		k = ServiceKey{FWMark: s.FWMark, AddressFamily: s.AddressFamily}
+	}
+	return k.normalize()
+}
+
+func (s *ServiceEntry) Serialize() (nl.NetlinkRequestData, error) {
+	var ip net.IP
+	var protocol uint16
 	var addressFamily uint16
-	addressFamily = syscall.AF_INET // 0x2
-	if ip.To4() == nil {
-		addressFamily = syscall.AF_INET6 //0xa
+
+	if s.FWMark == 0 {
+		ip = net.ParseIP(s.Address)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %s", s.Address)
+		}
+
+		switch s.Protocol {
+		case "TCP", "tcp", "Tcp":
+			protocol = syscall.IPPROTO_TCP //0x6
+		case "UDP", "udp", "Udp":
+			protocol = syscall.IPPROTO_UDP //0x11
+		case "SCTP", "sctp", "Sctp":
+			protocol = syscall.IPPROTO_SCTP //0x84
+		default:
+			return nil, fmt.Errorf("not support protocol %s", s.Protocol)
+		}
+
+		addressFamily = syscall.AF_INET // 0x2
+		if ip.To4() == nil {
+			addressFamily = syscall.AF_INET6 //0xa
+		}
+	} else {
+		// firewall mark services have no address, the family must be given
+		var err error
+		addressFamily, err = parseAddressFamily(s.AddressFamily)
+		if err != nil {
+			return nil, err
+		}
 	}
-	switch s.SchedName {
-	case "", "rr", "wrr", "lc", "wlc", "lblc", "able", "lblcr", "dh", "sh", "sed", "nq":
-	default:
-		return nil, fmt.Errorf("not support scheduler %s", s.SchedName)
+
+	if err := validSchedulerName(s.SchedName); err != nil {
+		return nil, err
 	}
 
 	cmdAttrService := nl.NewRtAttr(IPVS_CMD_ATTR_SERVICE, nil)
@@ -93,52 +160,152 @@ func (s *ServiceEntry) Serialize() (nl.NetlinkRequestData, error) {
 		flags: uint32(s.Flags),
 		mask:  0xFFFFFFFF,
 	}
+	if s.maskFlags {
+		f.mask = uint32(s.flagsMask)
+	}
 	nl.NewRtAttrChild(cmdAttrService, IPVS_SVC_ATTR_FLAGS, f.Serialize())
 	nl.NewRtAttrChild(cmdAttrService, IPVS_SVC_ATTR_TIMEOUT, nl.Uint32Attr(uint32(s.Timeout)))
-	nl.NewRtAttrChild(cmdAttrService, IPVS_SVC_ATTR_NETMASK, nl.Uint32Attr(uint32(s.Netmask)))
+	nl.NewRtAttrChild(cmdAttrService, IPVS_SVC_ATTR_NETMASK, nl.Uint32Attr(s.persistenceNetmask(addressFamily)))
 	return cmdAttrService, nil
 }
 
+// family returns the address family of the service.
+func (s *ServiceEntry) family() (uint16, error) {
+	if s.FWMark != 0 {
+		return parseAddressFamily(s.AddressFamily)
+	}
+	ip := net.ParseIP(s.Address)
+	if ip == nil {
+		return 0, fmt.Errorf("invalid IP address %s", s.Address)
+	}
+	if ip.To4() == nil {
+		return syscall.AF_INET6, nil
+	}
+	return syscall.AF_INET, nil
+}
+
+func parseAddressFamily(family string) (uint16, error) {
+	switch family {
+	case "", "IPv4", "ipv4":
+		return syscall.AF_INET, nil
+	case "IPv6", "ipv6":
+		return syscall.AF_INET6, nil
+	}
+	return 0, fmt.Errorf("not support address family %s", family)
+}
+
+func addressFamilyName(af uint16) string {
+	switch af {
+	case syscall.AF_INET:
+		return "IPv4"
+	case syscall.AF_INET6:
+		return "IPv6"
+	}
+	return ""
+}
+
+// family returns the address family of the destination, which may differ
+// from the family of its service when the TUN method is used.
+func (d *DestinationEntry) family() (uint16, error) {
+	ip := net.ParseIP(d.Address)
+	if ip == nil {
+		return 0, fmt.Errorf("invalid IP address %s", d.Address)
+	}
+	af := uint16(syscall.AF_INET)
+	if ip.To4() == nil {
+		af = syscall.AF_INET6
+	}
+	if d.AddressFamily != "" {
+		family, err := parseAddressFamily(d.AddressFamily)
+		if err != nil {
+			return 0, err
+		}
+		if family != af {
+			return 0, fmt.Errorf("address %s is not %s", d.Address, d.AddressFamily)
+		}
+	}
+	return af, nil
+}
+
+// validateFamily checks that a destination of another family than its
+// service is only used with the TUN method.
+func (d *DestinationEntry) validateFamily(s *ServiceEntry) error {
+	saf, err := s.family()
+	if err != nil {
+		return err
+	}
+	daf, err := d.family()
+	if err != nil {
+		return err
+	}
+	method, err := d.ForwardingMethod()
+	if err != nil {
+		return err
+	}
+	if saf != daf && method != ForwardTunnel {
+		return fmt.Errorf("%s destination %s behind %s service requires the TUN method",
+			addressFamilyName(daf), d.Address, addressFamilyName(saf))
+	}
+	return nil
+}
+
 type DestinationEntry struct {
 	Address        string `json:"RIP"`
 	Port           int    `json:"port"`
 	Weight         int    `json:"weight"`
-	Method         string `json:"method"`
+	Method         string `json:"method"` // see ForwardingMethod
 	AddressFamily  string `json:"addressfamily"`
-	UpperThreshold int
-	LowerThreshold int
+	UpperThreshold int    `json:"upperthreshold"`
+	LowerThreshold int    `json:"lowerthreshold"`
+
+	// Encapsulation of the TUN method: TunnelType is "ipip" (the default),
+	// "gue" or "gre", TunnelPort the UDP port of GUE and TunnelChecksum
+	// "nocsum" (the default), "csum" or "remcsum".
+	TunnelType     string `json:"tuntype,omitempty"`
+	TunnelPort     int    `json:"tunport,omitempty"`
+	TunnelChecksum string `json:"tunchecksum,omitempty"`
+
+	ActiveConnections   uint32 `json:"activeconns"`
+	InActiveConnections uint32 `json:"inactconns"`
+	PersistConnections  uint32 `json:"persistconns"`
+	Stats               Stats  `json:"stats"`
+}
 
-	ActiveConnections   uint32
-	InActiveConnections uint32
-	PersistConnections  uint32
-	Stats               Stats
+// DestinationKey identifies a real server inside a virtual service.
+type DestinationKey struct {
+	Address string `json:"RIP"`
+	Port    int    `json:"port"`
 }
 
-func (d *DestinationEntry) Serialize() (nl.NetlinkRequestData, error) {
-	ip := net.ParseIP(d.Address)
-	if ip == nil {
-		return nil, fmt.Errorf("invalid IP address %s", d.Address)
+func (k DestinationKey) String() string {
+	return net.JoinHostPort(k.Address, strconv.Itoa(k.Port))
+}
+
+func (d *DestinationEntry) Key() DestinationKey {
+	address := d.Address
+	if ip := net.ParseIP(d.Address); ip != nil {
+		address = ip.String()
 	}
+	return DestinationKey{Address: address, Port: d.Port}
+}
 
-	var method uint32
-	switch d.Method {
-	case "NAT":
-		method = IP_VS_CONN_F_MASQ
-	case "DR":
-		method = IP_VS_CONN_F_DROUTE
-	case "TUN":
-		method = IP_VS_CONN_F_TUNNEL
-	default:
-		return nil, errors.New("not support method " + d.Method)
+func (d *DestinationEntry) Serialize() (nl.NetlinkRequestData, error) {
+	addressFamily, err := d.family()
+	if err != nil {
+		return nil, err
 	}
+	ip := net.ParseIP(d.Address)
 
-	var addressFamily uint16
-	addressFamily = syscall.AF_INET
-	if ip.To4() == nil {
-		addressFamily = syscall.AF_INET6
+	method, err := d.ForwardingMethod()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.validateThresholds(); err != nil {
+		return nil, err
 	}
 
 	cmdAttrDest := nl.NewRtAttr(IPVS_CMD_ATTR_DEST, nil)
+	nl.NewRtAttrChild(cmdAttrDest, IPVS_DEST_ATTR_ADDR_FAMILY, nl.Uint16Attr(addressFamily))
 
 	switch addressFamily {
 	case syscall.AF_INET:
@@ -151,26 +318,44 @@ func (d *DestinationEntry) Serialize() (nl.NetlinkRequestData, error) {
 	binary.Write(portBuf, binary.BigEndian, uint16(d.Port))
 	nl.NewRtAttrChild(cmdAttrDest, IPVS_DEST_ATTR_PORT, portBuf.Bytes())
 
-	nl.NewRtAttrChild(cmdAttrDest, IPVS_DEST_ATTR_FWD_METHOD, nl.Uint32Attr(method&IP_VS_CONN_F_FWD_MASK))
+	nl.NewRtAttrChild(cmdAttrDest, IPVS_DEST_ATTR_FWD_METHOD, nl.Uint32Attr(uint32(method)&IP_VS_CONN_F_FWD_MASK))
 	nl.NewRtAttrChild(cmdAttrDest, IPVS_DEST_ATTR_WEIGHT, nl.Uint32Attr(uint32(d.Weight)))
 	nl.NewRtAttrChild(cmdAttrDest, IPVS_DEST_ATTR_U_THRESH, nl.Uint32Attr(uint32(d.UpperThreshold)))
 	nl.NewRtAttrChild(cmdAttrDest, IPVS_DEST_ATTR_L_THRESH, nl.Uint32Attr(uint32(d.LowerThreshold)))
 
+	if d.hasTunnelOptions() {
+		if method != ForwardTunnel {
+			return nil, fmt.Errorf("tunnel options require the TUN method")
+		}
+		tun, err := d.tunnel()
+		if err != nil {
+			return nil, err
+		}
+		nl.NewRtAttrChild(cmdAttrDest, IPVS_DEST_ATTR_TUN_TYPE, nl.Uint8Attr(tun.tunType))
+		tunPortBuf := new(bytes.Buffer)
+		binary.Write(tunPortBuf, binary.BigEndian, tun.port)
+		nl.NewRtAttrChild(cmdAttrDest, IPVS_DEST_ATTR_TUN_PORT, tunPortBuf.Bytes())
+		nl.NewRtAttrChild(cmdAttrDest, IPVS_DEST_ATTR_TUN_FLAGS, nl.Uint16Attr(tun.flags))
+	}
+
 	return cmdAttrDest, nil
 }
 
-// Stats defines an IPVS service statistics
+// Stats defines an IPVS service statistics. Is64Bit reports whether the
+// counters were read from the 64-bit IPVS_*_ATTR_STATS64 attributes; older
+// kernels only provide the 32-bit ones, which wrap around.
 type Stats struct {
-	Connections uint32 //IPVS_STATS_ATTR_CONNS
-	PacketsIn   uint32 //IPVS_STATS_ATTR_INPKTS
-	PacketsOut  uint32 //IPVS_STATS_ATTR_OUTPKTS
-	BytesIn     uint64 //IPVS_STATS_ATTR_INBYTES
-	BytesOut    uint64 //IPVS_STATS_ATTR_OUTBYTES
-	CPS         uint32 //IPVS_STATS_ATTR_CPS
-	PPSIn       uint32 //IPVS_STATS_ATTR_INPPS
-	PPSOut      uint32 //IPVS_STATS_ATTR_OUTPPS
-	BPSIn       uint32 //IPVS_STATS_ATTR_INBPS
-	BPSOut      uint32 //IPVS_STATS_ATTR_OUTBPS
+	Connections uint64 `json:"conns"`    //IPVS_STATS_ATTR_CONNS
+	PacketsIn   uint64 `json:"inpkts"`   //IPVS_STATS_ATTR_INPKTS
+	PacketsOut  uint64 `json:"outpkts"`  //IPVS_STATS_ATTR_OUTPKTS
+	BytesIn     uint64 `json:"inbytes"`  //IPVS_STATS_ATTR_INBYTES
+	BytesOut    uint64 `json:"outbytes"` //IPVS_STATS_ATTR_OUTBYTES
+	CPS         uint64 `json:"cps"`      //IPVS_STATS_ATTR_CPS
+	PPSIn       uint64 `json:"inpps"`    //IPVS_STATS_ATTR_INPPS
+	PPSOut      uint64 `json:"outpps"`   //IPVS_STATS_ATTR_OUTPPS
+	BPSIn       uint64 `json:"inbps"`    //IPVS_STATS_ATTR_INBPS
+	BPSOut      uint64 `json:"outbps"`   //IPVS_STATS_ATTR_OUTBPS
+	Is64Bit     bool   `json:"is64bit"`
 }
 
 func assembleServiceInterface(attrs []syscall.NetlinkRouteAttr) (*ServiceEntry, error) {
@@ -208,14 +393,25 @@ func assembleServiceInterface(attrs []syscall.NetlinkRouteAttr) (*ServiceEntry,
 			s.FWMark = int(native.Uint32(attr.Value))
 		case IPVS_SVC_ATTR_SCHED_NAME:
 			s.SchedName = nl.BytesToString(attr.Value)
+		case IPVS_SVC_ATTR_PE_NAME:
+			s.PEName = nl.BytesToString(attr.Value)
 		case IPVS_SVC_ATTR_FLAGS:
-			s.Flags = int(native.Uint32(attr.Value))
+			s.Flags = ServiceFlags(native.Uint32(attr.Value))
 		case IPVS_SVC_ATTR_TIMEOUT:
 			s.Timeout = int(native.Uint32(attr.Value))
 		case IPVS_SVC_ATTR_NETMASK:
 			s.Netmask = int(native.Uint32(attr.Value))
 		case IPVS_SVC_ATTR_STATS:
-			stats, err := assembleStats(attr.Value)
+			if s.Stats.Is64Bit {
+				continue
+			}
+			stats, err := assembleStats(attr.Value, false)
+			if err != nil {
+				return nil, err
+			}
+			s.Stats = stats
+		case IPVS_SVC_ATTR_STATS64:
+			stats, err := assembleStats(attr.Value, true)
 			if err != nil {
 				return nil, err
 			}
@@ -224,10 +420,14 @@ func assembleServiceInterface(attrs []syscall.NetlinkRouteAttr) (*ServiceEntry,
 
 	}
 
-	switch s.AddressFamily {
-	case "IPv4":
+	if s.FWMark != 0 {
+		return &s, nil
+	}
+
+	switch {
+	case s.AddressFamily == "IPv4" && len(addr) >= 4:
 		s.Address = (net.IP)(addr[:4]).String()
-	case "IPv6":
+	case s.AddressFamily == "IPv6" && len(addr) >= 16:
 		s.Address = (net.IP)(addr[:16]).String()
 	default:
 		return nil, fmt.Errorf("invalid IP address %v", addr)
@@ -236,9 +436,12 @@ func assembleServiceInterface(attrs []syscall.NetlinkRouteAttr) (*ServiceEntry,
 	return &s, nil
 }
 
-func assembleDestinationInterface(attrs []syscall.NetlinkRouteAttr) (*DestinationEntry, error) {
+// assembleDestinationInterface decodes a destination of a service of family
+// af. Kernels before 3.18 do not report the family of the destination, which
+// then is the one of the service.
+func assembleDestinationInterface(attrs []syscall.NetlinkRouteAttr, af uint16) (*DestinationEntry, error) {
 
-	var d DestinationEntry
+	d := DestinationEntry{AddressFamily: addressFamilyName(af)}
 	var addr []byte
 
 	for _, attr := range attrs {
@@ -249,16 +452,8 @@ func assembleDestinationInterface(attrs []syscall.NetlinkRouteAttr) (*Destinatio
 		case IPVS_DEST_ATTR_PORT:
 			d.Port = int(binary.BigEndian.Uint16(attr.Value))
 		case IPVS_DEST_ATTR_FWD_METHOD:
-			switch native.Uint32(attr.Value) {
-			case IP_VS_CONN_F_MASQ:
-				d.Method = "NAT"
-			case IP_VS_CONN_F_DROUTE:
-				d.Method = "DR"
-			case IP_VS_CONN_F_TUNNEL:
-				d.Method = "TUN"
-			default:
-				return nil, errors.New("not support method ")
-			}
+			// unknown methods are kept as "UNKNOWN(n)" rather than failing the dump
+			d.Method = ForwardingMethod(native.Uint32(attr.Value)).String()
 		case IPVS_DEST_ATTR_WEIGHT:
 			d.Weight = int(native.Uint16(attr.Value))
 		case IPVS_DEST_ATTR_U_THRESH:
@@ -272,16 +467,26 @@ func assembleDestinationInterface(attrs []syscall.NetlinkRouteAttr) (*Destinatio
 		case IPVS_DEST_ATTR_PERSIST_CONNS:
 			d.PersistConnections = native.Uint32(attr.Value)
 		case IPVS_DEST_ATTR_ADDR_FAMILY:
-			switch native.Uint16(attr.Value) {
-			case syscall.AF_INET:
-				d.AddressFamily = "IPv4"
-			case syscall.AF_INET6:
-				d.AddressFamily = "IPv6"
-			}
+			d.AddressFamily = addressFamilyName(native.Uint16(attr.Value))
 		case IPVS_DEST_ATTR_ADDR:
 			addr = attr.Value
-		case IPVS_SVC_ATTR_STATS:
-			stats, err := assembleStats(attr.Value)
+		case IPVS_DEST_ATTR_TUN_TYPE:
+			d.TunnelType = tunnelTypeName(attr.Value[0])
+		case IPVS_DEST_ATTR_TUN_PORT:
+			d.TunnelPort = int(binary.BigEndian.Uint16(attr.Value))
+		case IPVS_DEST_ATTR_TUN_FLAGS:
+			d.TunnelChecksum = tunnelChecksumName(native.Uint16(attr.Value))
+		case IPVS_DEST_ATTR_STATS:
+			if d.Stats.Is64Bit {
+				continue
+			}
+			stats, err := assembleStats(attr.Value, false)
+			if err != nil {
+				return nil, err
+			}
+			d.Stats = stats
+		case IPVS_DEST_ATTR_STATS64:
+			stats, err := assembleStats(attr.Value, true)
 			if err != nil {
 				return nil, err
 			}
@@ -289,19 +494,28 @@ func assembleDestinationInterface(attrs []syscall.NetlinkRouteAttr) (*Destinatio
 		}
 	}
 
-	switch d.AddressFamily {
-	case "IPv6":
+	// the kernel reports tunnel attributes for every destination
+	if d.Method != ForwardTunnel.String() {
+		d.TunnelType, d.TunnelPort, d.TunnelChecksum = "", 0, ""
+	}
+
+	switch {
+	case d.AddressFamily == "IPv4" && len(addr) >= 4:
+		d.Address = (net.IP)(addr[:4]).String()
+	case d.AddressFamily == "IPv6" && len(addr) >= 16:
 		d.Address = (net.IP)(addr[:16]).String()
 	default:
-		d.Address = (net.IP)(addr[:4]).String()
+		return nil, fmt.Errorf("invalid IP address %v", addr)
 	}
 
 	return &d, nil
 }
 
-func assembleStats(msg []byte) (Stats, error) {
+// assembleStats parses a nested stats attribute. In the 64-bit variant every
+// counter is a u64, otherwise only the byte counters are.
+func assembleStats(msg []byte, is64 bool) (Stats, error) {
 
-	var s Stats
+	s := Stats{Is64Bit: is64}
 
 	attrs, err := nl.ParseRouteAttr(msg)
 	if err != nil {
@@ -310,27 +524,38 @@ func assembleStats(msg []byte) (Stats, error) {
 
 	for _, attr := range attrs {
 		attrType := int(attr.Attr.Type)
+
+		var value uint64
+		switch {
+		case attrType == IPVS_STATS_ATTR_PAD:
+			continue
+		case is64 || attrType == IPVS_STATS_ATTR_INBYTES || attrType == IPVS_STATS_ATTR_OUTBYTES:
+			value = native.Uint64(attr.Value)
+		default:
+			value = uint64(native.Uint32(attr.Value))
+		}
+
 		switch attrType {
 		case IPVS_STATS_ATTR_CONNS:
-			s.Connections = native.Uint32(attr.Value)
+			s.Connections = value
 		case IPVS_STATS_ATTR_INPKTS:
-			s.PacketsIn = native.Uint32(attr.Value)
+			s.PacketsIn = value
 		case IPVS_STATS_ATTR_OUTPKTS:
-			s.PacketsOut = native.Uint32(attr.Value)
+			s.PacketsOut = value
 		case IPVS_STATS_ATTR_INBYTES:
-			s.BytesIn = native.Uint64(attr.Value)
+			s.BytesIn = value
 		case IPVS_STATS_ATTR_OUTBYTES:
-			s.BytesOut = native.Uint64(attr.Value)
+			s.BytesOut = value
 		case IPVS_STATS_ATTR_CPS:
-			s.CPS = native.Uint32(attr.Value)
+			s.CPS = value
 		case IPVS_STATS_ATTR_INPPS:
-			s.PPSIn = native.Uint32(attr.Value)
+			s.PPSIn = value
 		case IPVS_STATS_ATTR_OUTPPS:
-			s.PPSOut = native.Uint32(attr.Value)
+			s.PPSOut = value
 		case IPVS_STATS_ATTR_INBPS:
-			s.BPSIn = native.Uint32(attr.Value)
+			s.BPSIn = value
 		case IPVS_STATS_ATTR_OUTBPS:
-			s.BPSOut = native.Uint32(attr.Value)
+			s.BPSOut = value
 		}
 	}
 	return s, nil
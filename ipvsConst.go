@@ -83,6 +83,24 @@ const (
 	IPVS_DEST_ATTR_ADDR_FAMILY // Address family of address
 
 	IPVS_DEST_ATTR_STATS64 //nested attribute for dest stats
+
+	IPVS_DEST_ATTR_TUN_TYPE  // tunnel type
+	IPVS_DEST_ATTR_TUN_PORT  // tunnel port
+	IPVS_DEST_ATTR_TUN_FLAGS // tunnel flags
+)
+
+// Tunnel types
+const (
+	IP_VS_CONN_F_TUNNEL_TYPE_IPIP = 0 // IPIP
+	IP_VS_CONN_F_TUNNEL_TYPE_GUE  = 1 // GUE
+	IP_VS_CONN_F_TUNNEL_TYPE_GRE  = 2 // GRE
+)
+
+// Tunnel encapsulation flags
+const (
+	IP_VS_TUNNEL_ENCAP_FLAG_NOCSUM  = 0x0000 // no checksum
+	IP_VS_TUNNEL_ENCAP_FLAG_CSUM    = 0x0001 // checksum
+	IP_VS_TUNNEL_ENCAP_FLAG_REMCSUM = 0x0002 // remote checksum offload
 )
 
 /*
@@ -132,3 +150,48 @@ const (
 	IP_VS_CONN_F_TEMPLATE   = 0x1000 //template, not connection
 	IP_VS_CONN_F_ONE_PACKET = 0x2000 //forward only one packet
 )
+
+// Attributes used to describe a sync daemon. Used inside nested attribute
+// IPVS_CMD_ATTR_DAEMON.
+const (
+	IPVS_DAEMON_ATTR_UNSPEC       int = iota
+	IPVS_DAEMON_ATTR_STATE            // sync daemon state (master/backup)
+	IPVS_DAEMON_ATTR_MCAST_IFN        // multicast interface name
+	IPVS_DAEMON_ATTR_SYNC_ID          // SyncID we belong to
+	IPVS_DAEMON_ATTR_SYNC_MAXLEN      // UDP Payload Size
+	IPVS_DAEMON_ATTR_MCAST_GROUP      // IPv4 Multicast Address
+	IPVS_DAEMON_ATTR_MCAST_GROUP6     // IPv6 Multicast Address
+	IPVS_DAEMON_ATTR_MCAST_PORT       // Multicast Port (base)
+	IPVS_DAEMON_ATTR_MCAST_TTL        // Multicast TTL
+)
+
+// Sync daemon states
+const (
+	IP_VS_STATE_NONE   = 0x0000 // no sync daemon
+	IP_VS_STATE_MASTER = 0x0001 // started as master
+	IP_VS_STATE_BACKUP = 0x0002 // started as backup
+)
+
+// Attributes used in response to IPVS_CMD_GET_INFO command
+const (
+	IPVS_INFO_ATTR_UNSPEC        int = iota
+	IPVS_INFO_ATTR_VERSION           // IPVS version number
+	IPVS_INFO_ATTR_CONN_TAB_SIZE     // size of connection hash table
+)
+
+// Virtual Service Flags
+const (
+	IP_VS_SVC_F_PERSISTENT = 0x0001 // persistent port
+	IP_VS_SVC_F_HASHED     = 0x0002 // hashed entry
+	IP_VS_SVC_F_ONEPACKET  = 0x0004 // one-packet scheduling
+	IP_VS_SVC_F_SCHED1     = 0x0008 // scheduler flag 1
+	IP_VS_SVC_F_SCHED2     = 0x0010 // scheduler flag 2
+	IP_VS_SVC_F_SCHED3     = 0x0020 // scheduler flag 3
+)
+
+// Maximum length of scheduler and persistence engine names, including the
+// terminating NUL
+const (
+	IP_VS_SCHEDNAME_MAXLEN = 16
+	IP_VS_PENAME_MAXLEN    = 16
+)
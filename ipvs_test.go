@@ -1,7 +1,13 @@
 package libipvs
 
 import (
+	"errors"
+	"net"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
 )
 
 func TestFlush(t *testing.T) {
@@ -98,3 +104,290 @@ func TestAddAndDeleteService(t *testing.T) {
 		t.Fatalf("Failed delete service %s", err)
 	}
 }
+
+func TestZeroService(t *testing.T) {
+	ipvsHandler, err := NewIPVSHandler()
+	if err != nil {
+		t.Fatalf("Failed create IPVSHandler %s", err)
+	}
+
+	// the service forwards to a local listener, so a connection shows up
+	// in its statistics
+	l, err := net.Listen("tcp", "127.1.1.3:0")
+	if err != nil {
+		t.Fatalf("Failed listen %s", err)
+	}
+	defer l.Close()
+	key := ServiceKey{Address: "127.1.1.3", Port: l.Addr().(*net.TCPAddr).Port, Protocol: "TCP"}
+
+	err = ipvsHandler.AddService(key.Address, key.Port, key.Protocol, "rr")
+	if err != nil {
+		t.Fatalf("Failed add service %s", err)
+	}
+	defer ipvsHandler.DeleteService(key.Address, key.Port, key.Protocol)
+
+	si, err := ipvsHandler.GetService(key.Address, key.Port, key.Protocol)
+	if err != nil {
+		t.Fatalf("Failed get service %s", err)
+	}
+	err = ipvsHandler.AddDestination(si, key.Address, key.Port, 1, "LOCAL")
+	if err != nil {
+		t.Fatalf("Failed add destination %s", err)
+	}
+
+	conn, err := net.DialTimeout("tcp", l.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("Failed connect %s", err)
+	}
+	conn.Close()
+
+	si, err = ipvsHandler.GetService(key.Address, key.Port, key.Protocol)
+	if err != nil {
+		t.Fatalf("Failed get service %s", err)
+	}
+	if si.Stats.Connections == 0 || si.Stats.PacketsIn == 0 {
+		t.Fatalf("Expected statistics before zero %+v", si.Stats)
+	}
+
+	err = ipvsHandler.ZeroService(key)
+	if err != nil {
+		t.Fatalf("Failed zero service %s", err)
+	}
+	si, err = ipvsHandler.GetService(key.Address, key.Port, key.Protocol)
+	if err != nil {
+		t.Fatalf("Failed get service %s", err)
+	}
+	if si.Stats.Connections != 0 || si.Stats.PacketsIn != 0 || si.Stats.BytesIn != 0 {
+		t.Errorf("Failed zero service statistics %+v", si.Stats)
+	}
+	destinations, err := ipvsHandler.GetDestinations(si)
+	if err != nil {
+		t.Fatalf("Failed get destinations %s", err)
+	}
+	for _, d := range destinations {
+		if d.Stats.Connections != 0 || d.Stats.PacketsIn != 0 {
+			t.Errorf("Failed zero destination statistics %+v", d.Stats)
+		}
+	}
+
+	err = ipvsHandler.ZeroAll()
+	if err != nil {
+		t.Fatalf("Failed zero all %s", err)
+	}
+
+	err = ipvsHandler.ZeroService(ServiceKey{Address: "127.1.1.4", Port: key.Port, Protocol: key.Protocol})
+	if !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("Expected ErrServiceNotFound, got %v", err)
+	}
+}
+
+func parseServiceAttr(t *testing.T, s *ServiceEntry) *ServiceEntry {
+	attr, err := s.Serialize()
+	if err != nil {
+		t.Fatalf("Failed serialize service %s", err)
+	}
+	attrs, err := nl.ParseRouteAttr(attr.Serialize()[syscall.SizeofRtAttr:])
+	if err != nil {
+		t.Fatalf("Failed parse service %s", err)
+	}
+	got, err := assembleServiceInterface(attrs)
+	if err != nil {
+		t.Fatalf("Failed assemble service %s", err)
+	}
+	return got
+}
+
+func parseDestinationAttr(t *testing.T, d *DestinationEntry) *DestinationEntry {
+	attr, err := d.Serialize()
+	if err != nil {
+		t.Fatalf("Failed serialize destination %s", err)
+	}
+	attrs, err := nl.ParseRouteAttr(attr.Serialize()[syscall.SizeofRtAttr:])
+	if err != nil {
+		t.Fatalf("Failed parse destination %s", err)
+	}
+	got, err := assembleDestinationInterface(attrs, syscall.AF_INET)
+	if err != nil {
+		t.Fatalf("Failed assemble destination %s", err)
+	}
+	return got
+}
+
+func TestFWMarkServiceSerialize(t *testing.T) {
+	for _, family := range []string{"IPv4", "IPv6"} {
+		s := &ServiceEntry{FWMark: 10, AddressFamily: family, SchedName: "wrr"}
+		got := parseServiceAttr(t, s)
+		if got.FWMark != s.FWMark || got.AddressFamily != family || got.Address != "" {
+			t.Errorf("different service %+v", got)
+		}
+		if got.Key() != (ServiceKey{FWMark: 10, AddressFamily: family}) {
+			t.Errorf("different key %v", got.Key())
+		}
+	}
+
+	if _, err := (&ServiceEntry{FWMark: 10, AddressFamily: "inet"}).Serialize(); err == nil {
+		t.Errorf("invalid address family accepted")
+	}
+}
+
+func TestServicePersistence(t *testing.T) {
+	tests := []struct {
+		service *ServiceEntry
+		opts    []ServiceOption
+		netmask int
+		valid   bool
+	}{
+		{&ServiceEntry{Address: "127.1.1.1", Protocol: "TCP", Port: 80}, nil, 0, true},
+		{&ServiceEntry{Address: "127.1.1.1", Protocol: "TCP", Port: 80},
+			[]ServiceOption{WithPersistence(300 * time.Second), WithPersistenceNetmask(net.CIDRMask(24, 32))},
+			int(native.Uint32(net.CIDRMask(24, 32))), true},
+		{&ServiceEntry{Address: "2001:db8::1", Protocol: "TCP", Port: 80},
+			[]ServiceOption{WithPersistence(time.Minute), WithPersistenceNetmask(net.CIDRMask(64, 128))}, 64, true},
+		{&ServiceEntry{Address: "127.1.1.1", Protocol: "UDP", Port: 5060},
+			[]ServiceOption{WithPersistence(time.Minute), WithPersistenceEngine("sip")}, 0, true},
+		{&ServiceEntry{Address: "2001:db8::1", Protocol: "TCP", Port: 80},
+			[]ServiceOption{WithPersistence(time.Minute), WithPersistenceNetmask(net.CIDRMask(24, 32))}, 0, false},
+		{&ServiceEntry{Address: "127.1.1.1", Protocol: "TCP", Port: 80},
+			[]ServiceOption{WithPersistenceNetmask(net.CIDRMask(24, 32))}, 0, false},
+		{&ServiceEntry{Address: "127.1.1.1", Protocol: "UDP", Port: 5060},
+			[]ServiceOption{WithPersistenceEngine("sip")}, 0, false},
+	}
+	for i, test := range tests {
+		err := test.service.apply(test.opts)
+		if err == nil {
+			_, err = test.service.Serialize()
+		}
+		if err == nil {
+			af, _ := test.service.family()
+			err = test.service.validatePersistence(af)
+		}
+		if test.valid && err != nil {
+			t.Errorf("%d: Failed validate service %s", i, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%d: invalid persistence accepted", i)
+		}
+		if test.valid && test.netmask != 0 && test.service.Netmask != test.netmask {
+			t.Errorf("%d: different netmask %x", i, test.service.Netmask)
+		}
+	}
+
+	if err := WithPersistence(time.Millisecond)(&ServiceEntry{}); err == nil {
+		t.Errorf("invalid persistence timeout accepted")
+	}
+
+	// services read from the kernel are only validated when they are sent
+	// with NEW_SERVICE or SET_SERVICE
+	s := &ServiceEntry{Address: "127.1.1.1", Protocol: "UDP", Port: 5060, SchedName: "rr", PEName: "sip"}
+	if _, err := s.Serialize(); err != nil {
+		t.Errorf("Failed serialize service %s", err)
+	}
+}
+
+func TestStats64(t *testing.T) {
+	stats := nl.NewRtAttr(IPVS_SVC_ATTR_STATS, nil)
+	nl.NewRtAttrChild(stats, IPVS_STATS_ATTR_CONNS, nl.Uint32Attr(0xFFFFFFFF))
+	nl.NewRtAttrChild(stats, IPVS_STATS_ATTR_INBYTES, nl.Uint64Attr(1<<40))
+	stats64 := nl.NewRtAttr(IPVS_SVC_ATTR_STATS64, nil)
+	nl.NewRtAttrChild(stats64, IPVS_STATS_ATTR_CONNS, nl.Uint64Attr(1<<33))
+	nl.NewRtAttrChild(stats64, IPVS_STATS_ATTR_INBYTES, nl.Uint64Attr(1<<40))
+
+	attrs := []syscall.NetlinkRouteAttr{
+		{Attr: syscall.RtAttr{Type: uint16(IPVS_SVC_ATTR_AF)}, Value: nl.Uint16Attr(syscall.AF_INET)},
+		{Attr: syscall.RtAttr{Type: uint16(IPVS_SVC_ATTR_ADDR)}, Value: net.ParseIP("127.1.1.1").To4()},
+		{Attr: syscall.RtAttr{Type: uint16(IPVS_SVC_ATTR_STATS)}, Value: stats.Serialize()[syscall.SizeofRtAttr:]},
+	}
+	s, err := assembleServiceInterface(attrs)
+	if err != nil {
+		t.Fatalf("Failed assemble service %s", err)
+	}
+	if s.Stats.Is64Bit || s.Stats.Connections != 0xFFFFFFFF || s.Stats.BytesIn != 1<<40 {
+		t.Errorf("different stats %+v", s.Stats)
+	}
+
+	attrs = append(attrs, syscall.NetlinkRouteAttr{
+		Attr: syscall.RtAttr{Type: uint16(IPVS_SVC_ATTR_STATS64)}, Value: stats64.Serialize()[syscall.SizeofRtAttr:]})
+	s, err = assembleServiceInterface(attrs)
+	if err != nil {
+		t.Fatalf("Failed assemble service %s", err)
+	}
+	if !s.Stats.Is64Bit || s.Stats.Connections != 1<<33 || s.Stats.BytesIn != 1<<40 {
+		t.Errorf("different stats %+v", s.Stats)
+	}
+}
+
+func TestDestinationFamily(t *testing.T) {
+	got := parseDestinationAttr(t, &DestinationEntry{Address: "2001:db8::1", Port: 80, Method: "TUN"})
+	if got.AddressFamily != "IPv6" || got.Address != "2001:db8::1" {
+		t.Errorf("different destination %s/%s", got.Address, got.AddressFamily)
+	}
+
+	// without IPVS_DEST_ATTR_ADDR_FAMILY the family of the service is used
+	attrs := []syscall.NetlinkRouteAttr{
+		{Attr: syscall.RtAttr{Type: uint16(IPVS_DEST_ATTR_ADDR)}, Value: net.ParseIP("2001:db8::1")},
+	}
+	d, err := assembleDestinationInterface(attrs, syscall.AF_INET6)
+	if err != nil {
+		t.Fatalf("Failed assemble destination %s", err)
+	}
+	if d.AddressFamily != "IPv6" || d.Address != "2001:db8::1" {
+		t.Errorf("different destination %s/%s", d.Address, d.AddressFamily)
+	}
+
+	si := &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80}
+	if err := (&DestinationEntry{Address: "2001:db8::1", Method: "TUN"}).validateFamily(si); err != nil {
+		t.Errorf("Failed validate TUN destination %s", err)
+	}
+	if err := (&DestinationEntry{Address: "2001:db8::1", Method: "NAT"}).validateFamily(si); err == nil {
+		t.Errorf("Expected error for mixed family NAT destination")
+	}
+	if _, err := (&DestinationEntry{Address: "10.0.0.2", Method: "NAT", AddressFamily: "IPv6"}).Serialize(); err == nil {
+		t.Errorf("Expected error for mismatched address family")
+	}
+}
+
+func TestForwardingMethod(t *testing.T) {
+	for _, method := range []string{"NAT", "LOCAL", "TUN", "DR", "BYPASS"} {
+		got := parseDestinationAttr(t, &DestinationEntry{Address: "10.0.0.1", Port: 80, Method: method})
+		if got.Method != method {
+			t.Errorf("different method %s, want %s", got.Method, method)
+		}
+	}
+
+	attrs := []syscall.NetlinkRouteAttr{
+		{Attr: syscall.RtAttr{Type: uint16(IPVS_DEST_ATTR_ADDR)}, Value: net.ParseIP("10.0.0.1").To4()},
+		{Attr: syscall.RtAttr{Type: uint16(IPVS_DEST_ATTR_FWD_METHOD)}, Value: nl.Uint32Attr(7)},
+	}
+	d, err := assembleDestinationInterface(attrs, syscall.AF_INET)
+	if err != nil {
+		t.Fatalf("Failed assemble destination %s", err)
+	}
+	if d.Method != "UNKNOWN(7)" {
+		t.Errorf("different method %s", d.Method)
+	}
+	if got := parseDestinationAttr(t, d); got.Method != "UNKNOWN(7)" {
+		t.Errorf("different method %s after serialize", got.Method)
+	}
+	if _, err := ParseForwardingMethod("UNKNOWN(8)"); err == nil {
+		t.Errorf("Expected error for method outside the forwarding mask")
+	}
+}
+
+func TestDestinationThresholds(t *testing.T) {
+	d := &DestinationEntry{Address: "10.0.0.1", Port: 80, Method: "NAT"}
+	if err := d.apply([]DestinationOption{WithUpperThreshold(1000), WithLowerThreshold(800)}); err != nil {
+		t.Fatalf("Failed apply option %s", err)
+	}
+	got := parseDestinationAttr(t, d)
+	if got.UpperThreshold != 1000 || got.LowerThreshold != 800 {
+		t.Errorf("different thresholds %d/%d", got.UpperThreshold, got.LowerThreshold)
+	}
+
+	if err := d.apply([]DestinationOption{WithUpperThreshold(-1)}); err == nil {
+		t.Errorf("Expected error for negative threshold")
+	}
+	d.UpperThreshold, d.LowerThreshold = 100, 200
+	if _, err := d.Serialize(); err == nil {
+		t.Errorf("Expected error for lower threshold above upper threshold")
+	}
+}
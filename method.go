@@ -0,0 +1,67 @@
+package libipvs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ForwardingMethod is the way packets are forwarded to a destination.
+type ForwardingMethod uint32
+
+const (
+	ForwardNAT         ForwardingMethod = IP_VS_CONN_F_MASQ      // masquerading
+	ForwardLocal       ForwardingMethod = IP_VS_CONN_F_LOCALNODE // delivered to the local host
+	ForwardTunnel      ForwardingMethod = IP_VS_CONN_F_TUNNEL    // encapsulated
+	ForwardDirectRoute ForwardingMethod = IP_VS_CONN_F_DROUTE    // direct routing
+	ForwardBypass      ForwardingMethod = IP_VS_CONN_F_BYPASS    // cache bypass
+)
+
+var forwardingMethodNames = map[ForwardingMethod]string{
+	ForwardNAT:         "NAT",
+	ForwardLocal:       "LOCAL",
+	ForwardTunnel:      "TUN",
+	ForwardDirectRoute: "DR",
+	ForwardBypass:      "BYPASS",
+}
+
+// String returns the name used in DestinationEntry.Method, or "UNKNOWN(n)"
+// for a value this package does not know.
+func (m ForwardingMethod) String() string {
+	if name, ok := forwardingMethodNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", uint32(m))
+}
+
+// ParseForwardingMethod parses "NAT", "LOCAL", "TUN", "DR" or "BYPASS".
+// MASQ, LOCALNODE, TUNNEL and ROUTE are accepted too; case is ignored.
+// "UNKNOWN(n)", as returned by String, gives back the raw value n so that
+// destinations read from a newer kernel can be updated and deleted.
+func ParseForwardingMethod(s string) (ForwardingMethod, error) {
+	s = strings.ToUpper(s)
+	if strings.HasPrefix(s, "UNKNOWN(") && strings.HasSuffix(s, ")") {
+		n, err := strconv.ParseUint(s[len("UNKNOWN("):len(s)-1], 10, 32)
+		if err == nil && n&^IP_VS_CONN_F_FWD_MASK == 0 {
+			return ForwardingMethod(n), nil
+		}
+	}
+	switch s {
+	case "NAT", "MASQ":
+		return ForwardNAT, nil
+	case "LOCAL", "LOCALNODE":
+		return ForwardLocal, nil
+	case "TUN", "TUNNEL":
+		return ForwardTunnel, nil
+	case "DR", "ROUTE":
+		return ForwardDirectRoute, nil
+	case "BYPASS":
+		return ForwardBypass, nil
+	}
+	return 0, fmt.Errorf("not support method %s", s)
+}
+
+// ForwardingMethod returns the parsed Method of the destination.
+func (d *DestinationEntry) ForwardingMethod() (ForwardingMethod, error) {
+	return ParseForwardingMethod(d.Method)
+}
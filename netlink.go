@@ -0,0 +1,406 @@
+package libipvs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+)
+
+const (
+	// readBufferSize is the size of the buffer used for a single recvfrom.
+	// The kernel never builds dump messages larger than 32KiB.
+	readBufferSize = 32 * 1024
+
+	solNetlink    = 270 // SOL_NETLINK
+	netlinkExtAck = 11  // NETLINK_EXT_ACK
+
+	nlmFCapped  = 0x100 // NLM_F_CAPPED
+	nlmFAckTLVs = 0x200 // NLM_F_ACK_TLVS
+
+	nlmsgerrAttrMsg  = 1 // NLMSGERR_ATTR_MSG
+	nlmsgerrAttrOffs = 2 // NLMSGERR_ATTR_OFFS
+
+	// cancelPollInterval bounds how long a receive blocks before the
+	// request context is checked again.
+	cancelPollInterval = 100 * time.Millisecond
+)
+
+var errHandlerClosed = errors.New("ipvs handler is closed")
+
+// openSocket creates the generic netlink socket shared by every request of h
+// inside the network namespace ns, or the current one if ns is not open.
+func (h *IPVSHandler) openSocket(ns netns.NsHandle) error {
+	sock, err := nl.GetNetlinkSocketAt(ns, netns.None(), syscall.NETLINK_GENERIC)
+	if err != nil {
+		return err
+	}
+
+	if h.rcvBufSize > 0 {
+		err = syscall.SetsockoptInt(sock.GetFd(), syscall.SOL_SOCKET, syscall.SO_RCVBUF, h.rcvBufSize)
+		if err != nil {
+			sock.Close()
+			return err
+		}
+	}
+
+	// Extended ACKs are best effort, kernels older than 4.12 reject the option.
+	err = syscall.SetsockoptInt(sock.GetFd(), solNetlink, netlinkExtAck, 1)
+	if err != nil && err != syscall.ENOPROTOOPT {
+		sock.Close()
+		return err
+	}
+
+	pid, err := sock.GetPid()
+	if err != nil {
+		sock.Close()
+		return err
+	}
+
+	h.sock = sock
+	h.pid = pid
+	h.rbuf = make([]byte, readBufferSize)
+	return nil
+}
+
+// Close releases the netlink socket. The handler must not be used afterwards.
+func (h *IPVSHandler) Close() error {
+	h.lock <- struct{}{}
+	defer func() { <-h.lock }()
+
+	if h.sock == nil {
+		return nil
+	}
+	h.sock.Close()
+	h.sock = nil
+	return nil
+}
+
+// execute sends req on the shared socket and collects the replies belonging
+// to it. Replies carrying another sequence number are left-overs of earlier
+// requests, possibly aborted by their context, and are skipped.
+func (h *IPVSHandler) execute(ctx context.Context, req *nl.NetlinkRequest) ([][]byte, error) {
+	select {
+	case h.lock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-h.lock }()
+
+	if h.sock == nil {
+		return nil, errHandlerClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := h.drain(ctx); err != nil {
+		return nil, err
+	}
+
+	h.seq++
+	req.Seq = h.seq
+
+	if err := h.sock.Send(req); err != nil {
+		return nil, err
+	}
+
+	dump := req.Flags&syscall.NLM_F_DUMP == syscall.NLM_F_DUMP
+	ack := req.Flags&syscall.NLM_F_ACK != 0
+
+	var res [][]byte
+	for {
+		msgs, err := h.receive(ctx)
+		if err != nil {
+			if dump {
+				h.dumpSeq = req.Seq
+			}
+			return nil, err
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != req.Seq {
+				continue
+			}
+			if m.Header.Pid != h.pid {
+				return nil, fmt.Errorf("wrong pid %d, expected %d", m.Header.Pid, h.pid)
+			}
+
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE, syscall.NLMSG_ERROR:
+				if err := parseNetlinkError(m, req); err != nil {
+					return nil, err
+				}
+				return res, nil
+			}
+
+			res = append(res, append([]byte(nil), m.Data...))
+			if !dump && !ack && m.Header.Flags&syscall.NLM_F_MULTI == 0 {
+				return res, nil
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			if dump {
+				h.dumpSeq = req.Seq
+			}
+			return nil, err
+		}
+	}
+}
+
+// drain reads the rest of a dump aborted by its context. The kernel refuses
+// to start another dump on the socket until the previous one is consumed.
+func (h *IPVSHandler) drain(ctx context.Context) error {
+	for h.dumpSeq != 0 {
+		msgs, err := h.receive(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != h.dumpSeq {
+				continue
+			}
+			if m.Header.Type == syscall.NLMSG_DONE || m.Header.Type == syscall.NLMSG_ERROR {
+				h.dumpSeq = 0
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// receive reads the next datagram from the socket. If ctx can be cancelled
+// the read is split in short timed reads so that cancellation and the
+// deadline are noticed.
+func (h *IPVSHandler) receive(ctx context.Context) ([]syscall.NetlinkMessage, error) {
+	for {
+		var timeout time.Duration
+		if ctx.Done() != nil {
+			timeout = cancelPollInterval
+			if deadline, ok := ctx.Deadline(); ok {
+				if remain := time.Until(deadline); remain < timeout {
+					timeout = remain
+				}
+			}
+			if timeout <= 0 {
+				return nil, context.DeadlineExceeded
+			}
+		}
+		if err := h.setReceiveTimeout(timeout); err != nil {
+			return nil, err
+		}
+
+		n, _, err := syscall.Recvfrom(h.sock.GetFd(), h.rbuf, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n < syscall.NLMSG_HDRLEN {
+			return nil, fmt.Errorf("got short response from netlink")
+		}
+		return syscall.ParseNetlinkMessage(h.rbuf[:n])
+	}
+}
+
+// setReceiveTimeout sets SO_RCVTIMEO, zero meaning no timeout.
+func (h *IPVSHandler) setReceiveTimeout(timeout time.Duration) error {
+	if timeout == h.rcvTimeout {
+		return nil
+	}
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	if timeout > 0 && tv.Sec == 0 && tv.Usec == 0 {
+		tv.Usec = 1
+	}
+	if err := syscall.SetsockoptTimeval(h.sock.GetFd(), syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		return err
+	}
+	h.rcvTimeout = timeout
+	return nil
+}
+
+// netlinkError is a kernel errno extended with the extended ACK attributes
+// the kernel attached to it.
+type netlinkError struct {
+	Errno     syscall.Errno
+	Message   string
+	Attribute string
+}
+
+func (e *netlinkError) Error() string {
+	msg := e.Errno.Error()
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Attribute != "" {
+		msg += " (" + e.Attribute + ")"
+	}
+	return msg
+}
+
+func (e *netlinkError) Unwrap() error {
+	return e.Errno
+}
+
+// parseNetlinkError decodes the error code carried by NLMSG_ERROR and
+// NLMSG_DONE messages answering req. A plain syscall.Errno is returned unless
+// the kernel attached an extended ACK.
+func parseNetlinkError(m syscall.NetlinkMessage, req *nl.NetlinkRequest) error {
+	b := m.Data
+	if len(b) < 4 {
+		return nil
+	}
+	errno := int32(native.Uint32(b[0:4]))
+	if errno == 0 {
+		return nil
+	}
+	err := syscall.Errno(-errno)
+	if m.Header.Flags&nlmFAckTLVs == 0 {
+		return err
+	}
+
+	// NLMSG_ERROR echoes the request header, and the whole request unless
+	// the reply is capped, before the TLVs.
+	tlvs := b[4:]
+	if m.Header.Type == syscall.NLMSG_ERROR {
+		if len(tlvs) < syscall.NLMSG_HDRLEN {
+			return err
+		}
+		skip := syscall.NLMSG_HDRLEN
+		if m.Header.Flags&nlmFCapped == 0 {
+			skip = int(native.Uint32(tlvs[0:4]))
+		}
+		if skip > len(tlvs) {
+			return err
+		}
+		tlvs = tlvs[skip:]
+	}
+
+	attrs, perr := nl.ParseRouteAttr(tlvs)
+	if perr != nil {
+		return err
+	}
+	nerr := &netlinkError{Errno: err}
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case nlmsgerrAttrMsg:
+			nerr.Message = strings.TrimRight(string(attr.Value), "\x00")
+		case nlmsgerrAttrOffs:
+			if len(attr.Value) >= 4 {
+				nerr.Attribute = attributeAt(req, native.Uint32(attr.Value))
+			}
+		}
+	}
+	if nerr.Message == "" && nerr.Attribute == "" {
+		return err
+	}
+	return nerr
+}
+
+var (
+	cmdAttrNames = map[int]string{
+		IPVS_CMD_ATTR_SERVICE:         "IPVS_CMD_ATTR_SERVICE",
+		IPVS_CMD_ATTR_DEST:            "IPVS_CMD_ATTR_DEST",
+		IPVS_CMD_ATTR_DAEMON:          "IPVS_CMD_ATTR_DAEMON",
+		IPVS_CMD_ATTR_TIMEOUT_TCP:     "IPVS_CMD_ATTR_TIMEOUT_TCP",
+		IPVS_CMD_ATTR_TIMEOUT_TCP_FIN: "IPVS_CMD_ATTR_TIMEOUT_TCP_FIN",
+		IPVS_CMD_ATTR_TIMEOUT_UDP:     "IPVS_CMD_ATTR_TIMEOUT_UDP",
+	}
+	svcAttrNames = map[int]string{
+		IPVS_SVC_ATTR_AF:         "IPVS_SVC_ATTR_AF",
+		IPVS_SVC_ATTR_PROTOCOL:   "IPVS_SVC_ATTR_PROTOCOL",
+		IPVS_SVC_ATTR_ADDR:       "IPVS_SVC_ATTR_ADDR",
+		IPVS_SVC_ATTR_PORT:       "IPVS_SVC_ATTR_PORT",
+		IPVS_SVC_ATTR_FWMARK:     "IPVS_SVC_ATTR_FWMARK",
+		IPVS_SVC_ATTR_SCHED_NAME: "IPVS_SVC_ATTR_SCHED_NAME",
+		IPVS_SVC_ATTR_FLAGS:      "IPVS_SVC_ATTR_FLAGS",
+		IPVS_SVC_ATTR_TIMEOUT:    "IPVS_SVC_ATTR_TIMEOUT",
+		IPVS_SVC_ATTR_NETMASK:    "IPVS_SVC_ATTR_NETMASK",
+		IPVS_SVC_ATTR_STATS:      "IPVS_SVC_ATTR_STATS",
+		IPVS_SVC_ATTR_PE_NAME:    "IPVS_SVC_ATTR_PE_NAME",
+		IPVS_SVC_ATTR_STATS64:    "IPVS_SVC_ATTR_STATS64",
+	}
+	destAttrNames = map[int]string{
+		IPVS_DEST_ATTR_ADDR:          "IPVS_DEST_ATTR_ADDR",
+		IPVS_DEST_ATTR_PORT:          "IPVS_DEST_ATTR_PORT",
+		IPVS_DEST_ATTR_FWD_METHOD:    "IPVS_DEST_ATTR_FWD_METHOD",
+		IPVS_DEST_ATTR_WEIGHT:        "IPVS_DEST_ATTR_WEIGHT",
+		IPVS_DEST_ATTR_U_THRESH:      "IPVS_DEST_ATTR_U_THRESH",
+		IPVS_DEST_ATTR_L_THRESH:      "IPVS_DEST_ATTR_L_THRESH",
+		IPVS_DEST_ATTR_ACTIVE_CONNS:  "IPVS_DEST_ATTR_ACTIVE_CONNS",
+		IPVS_DEST_ATTR_INACT_CONNS:   "IPVS_DEST_ATTR_INACT_CONNS",
+		IPVS_DEST_ATTR_PERSIST_CONNS: "IPVS_DEST_ATTR_PERSIST_CONNS",
+		IPVS_DEST_ATTR_STATS:         "IPVS_DEST_ATTR_STATS",
+		IPVS_DEST_ATTR_ADDR_FAMILY:   "IPVS_DEST_ATTR_ADDR_FAMILY",
+		IPVS_DEST_ATTR_STATS64:       "IPVS_DEST_ATTR_STATS64",
+		IPVS_DEST_ATTR_TUN_TYPE:      "IPVS_DEST_ATTR_TUN_TYPE",
+		IPVS_DEST_ATTR_TUN_PORT:      "IPVS_DEST_ATTR_TUN_PORT",
+		IPVS_DEST_ATTR_TUN_FLAGS:     "IPVS_DEST_ATTR_TUN_FLAGS",
+	}
+	daemonAttrNames = map[int]string{
+		IPVS_DAEMON_ATTR_STATE:        "IPVS_DAEMON_ATTR_STATE",
+		IPVS_DAEMON_ATTR_MCAST_IFN:    "IPVS_DAEMON_ATTR_MCAST_IFN",
+		IPVS_DAEMON_ATTR_SYNC_ID:      "IPVS_DAEMON_ATTR_SYNC_ID",
+		IPVS_DAEMON_ATTR_SYNC_MAXLEN:  "IPVS_DAEMON_ATTR_SYNC_MAXLEN",
+		IPVS_DAEMON_ATTR_MCAST_GROUP:  "IPVS_DAEMON_ATTR_MCAST_GROUP",
+		IPVS_DAEMON_ATTR_MCAST_GROUP6: "IPVS_DAEMON_ATTR_MCAST_GROUP6",
+		IPVS_DAEMON_ATTR_MCAST_PORT:   "IPVS_DAEMON_ATTR_MCAST_PORT",
+		IPVS_DAEMON_ATTR_MCAST_TTL:    "IPVS_DAEMON_ATTR_MCAST_TTL",
+	}
+	// nestedAttrNames maps the nested first level attributes to the names of
+	// the attributes they contain.
+	nestedAttrNames = map[int]map[int]string{
+		IPVS_CMD_ATTR_SERVICE: svcAttrNames,
+		IPVS_CMD_ATTR_DEST:    destAttrNames,
+		IPVS_CMD_ATTR_DAEMON:  daemonAttrNames,
+	}
+)
+
+// attributeAt returns the name of the IPVS attribute found at offset off of
+// the serialized req, as reported by NLMSGERR_ATTR_OFFS.
+func attributeAt(req *nl.NetlinkRequest, off uint32) string {
+	if req.Type == nl.GENL_ID_CTRL {
+		return ""
+	}
+	b := req.Serialize()
+	start := syscall.NLMSG_HDRLEN + nl.SizeofGenlmsg
+	if int(off) < start || int(off) >= len(b) {
+		return ""
+	}
+	return attributeIn(b[start:], int(off)-start, cmdAttrNames, nestedAttrNames)
+}
+
+func attributeIn(b []byte, off int, names map[int]string, nested map[int]map[int]string) string {
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		return ""
+	}
+	pos := 0
+	for _, attr := range attrs {
+		end := pos + syscall.SizeofRtAttr + len(attr.Value)
+		if off < end {
+			attrType := int(attr.Attr.Type) &^ syscall.NLA_F_NESTED
+			if children, ok := nested[attrType]; ok && off >= pos+syscall.SizeofRtAttr {
+				if name := attributeIn(attr.Value, off-pos-syscall.SizeofRtAttr, children, nil); name != "" {
+					return name
+				}
+			}
+			if name, ok := names[attrType]; ok {
+				return name
+			}
+			return fmt.Sprintf("attribute %d", attrType)
+		}
+		pos = (end + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+	}
+	return ""
+}
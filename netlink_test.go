@@ -0,0 +1,68 @@
+package libipvs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+)
+
+func TestParseExtendedAck(t *testing.T) {
+	si := &ServiceEntry{Address: "127.1.1.1", Protocol: "TCP", Port: 8888, SchedName: "wlc"}
+	serviceAttr, err := si.Serialize()
+	if err != nil {
+		t.Fatalf("Failed serialize service %s", err)
+	}
+	req := nl.NewNetlinkRequest(0x20, syscall.NLM_F_ACK)
+	req.AddData(&nl.Genlmsg{Command: IPVS_CMD_NEW_SERVICE, Version: 1})
+	req.AddData(serviceAttr)
+
+	off := bytes.Index(req.Serialize(), nl.ZeroTerminated("wlc")) - syscall.SizeofRtAttr
+
+	data := make([]byte, 4+syscall.NLMSG_HDRLEN)
+	errno := -int32(syscall.ENOENT)
+	native.PutUint32(data, uint32(errno))
+	data = append(data, nl.NewRtAttr(nlmsgerrAttrMsg, nl.ZeroTerminated("scheduler not found")).Serialize()...)
+	data = append(data, nl.NewRtAttr(nlmsgerrAttrOffs, nl.Uint32Attr(uint32(off))).Serialize()...)
+	m := syscall.NetlinkMessage{
+		Header: syscall.NlMsghdr{Type: syscall.NLMSG_ERROR, Flags: nlmFCapped | nlmFAckTLVs},
+		Data:   data,
+	}
+
+	oe := newOperationError(IPVS_CMD_NEW_SERVICE, si, nil, parseNetlinkError(m, req))
+	if !errors.Is(oe, ErrSchedulerNotFound) {
+		t.Errorf("%v does not match ErrSchedulerNotFound", oe)
+	}
+	if oe.Message != "scheduler not found" {
+		t.Errorf("different message %q", oe.Message)
+	}
+	if oe.Attribute != "IPVS_SVC_ATTR_SCHED_NAME" {
+		t.Errorf("different attribute %q", oe.Attribute)
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	h := &IPVSHandler{lock: make(chan struct{}, 1)}
+	if err := h.openSocket(netns.None()); err != nil {
+		t.Skipf("generic netlink unavailable: %s", err)
+	}
+	defer h.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := h.GetServicesContext(ctx); err != context.Canceled {
+		t.Errorf("different error %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+	if _, err := h.GetAllEntryContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("different error %v", err)
+	}
+}
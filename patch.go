@@ -0,0 +1,135 @@
+package libipvs
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// ServicePatch lists the attributes PatchService changes. Nil fields keep
+// the current value of the service.
+type ServicePatch struct {
+	SchedName  *string
+	Flags      *ServiceFlags // replaces all flags
+	SetFlags   ServiceFlags  // flags to set, the others are kept
+	ClearFlags ServiceFlags  // flags to clear, the others are kept
+	// Persistence sets the persistence timeout; zero disables persistence
+	// and resets the netmask and persistence engine.
+	Persistence        *time.Duration
+	PersistenceNetmask net.IPMask
+	PEName             *string
+}
+
+func (p *ServicePatch) apply(s *ServiceEntry) error {
+	if p.SchedName != nil {
+		s.SchedName = *p.SchedName
+	}
+	if p.Flags != nil {
+		s.SetFlags(*p.Flags)
+		s.ClearFlags(^*p.Flags)
+	}
+	if p.SetFlags != 0 {
+		s.SetFlags(p.SetFlags)
+	}
+	if p.ClearFlags != 0 {
+		s.ClearFlags(p.ClearFlags)
+	}
+	if p.Persistence != nil {
+		if *p.Persistence == 0 {
+			s.ClearFlags(ServiceFlagPersistent)
+			s.Timeout, s.Netmask, s.PEName = 0, 0, ""
+		} else if err := WithPersistence(*p.Persistence)(s); err != nil {
+			return err
+		}
+	}
+	if p.PersistenceNetmask != nil {
+		if err := WithPersistenceNetmask(p.PersistenceNetmask)(s); err != nil {
+			return err
+		}
+	}
+	if p.PEName != nil {
+		s.PEName = *p.PEName
+	}
+	return nil
+}
+
+// PatchService changes the attributes of the service key set in p and
+// keeps the others, unlike UpdateService which resets them.
+func (h *IPVSHandler) PatchService(key ServiceKey, p ServicePatch) error {
+	return h.PatchServiceContext(context.Background(), key, p)
+}
+
+func (h *IPVSHandler) PatchServiceContext(ctx context.Context, key ServiceKey, p ServicePatch) error {
+	cmd := IPVS_CMD_SET_SERVICE
+	si, err := h.getService(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := p.apply(si); err != nil {
+		return invalidArgument(cmd, si, nil, err)
+	}
+
+	_, err = h.sendRequest(ctx, cmd, si, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DestinationPatch lists the attributes PatchDestination changes. Nil
+// fields keep the current value of the destination.
+type DestinationPatch struct {
+	Weight         *int
+	Method         *string
+	UpperThreshold *int
+	LowerThreshold *int
+	TunnelType     *string
+	TunnelPort     *int
+	TunnelChecksum *string
+}
+
+func (p *DestinationPatch) apply(d *DestinationEntry) {
+	if p.Weight != nil {
+		d.Weight = *p.Weight
+	}
+	if p.Method != nil {
+		d.Method = *p.Method
+		if m, _ := d.ForwardingMethod(); m != ForwardTunnel {
+			d.TunnelType, d.TunnelPort, d.TunnelChecksum = "", 0, ""
+		}
+	}
+	if p.UpperThreshold != nil {
+		d.UpperThreshold = *p.UpperThreshold
+	}
+	if p.LowerThreshold != nil {
+		d.LowerThreshold = *p.LowerThreshold
+	}
+	if p.TunnelType != nil {
+		d.TunnelType = *p.TunnelType
+	}
+	if p.TunnelPort != nil {
+		d.TunnelPort = *p.TunnelPort
+	}
+	if p.TunnelChecksum != nil {
+		d.TunnelChecksum = *p.TunnelChecksum
+	}
+}
+
+// PatchDestination changes the attributes of the destination dkey of the
+// service key set in p and keeps the others.
+func (h *IPVSHandler) PatchDestination(key ServiceKey, dkey DestinationKey, p DestinationPatch) error {
+	return h.PatchDestinationContext(context.Background(), key, dkey, p)
+}
+
+func (h *IPVSHandler) PatchDestinationContext(ctx context.Context, key ServiceKey, dkey DestinationKey, p DestinationPatch) error {
+	si, err := h.getService(ctx, key)
+	if err != nil {
+		return err
+	}
+	di, err := h.GetDestinationContext(ctx, si, dkey.Address, dkey.Port)
+	if err != nil {
+		return err
+	}
+	p.apply(di)
+	return h.UpdateDestinationEntryContext(ctx, si, di)
+}
@@ -0,0 +1,79 @@
+package libipvs
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServicePatch(t *testing.T) {
+	s := &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, AddressFamily: "IPv4", SchedName: "wlc",
+		Flags: ServiceFlagHashed | ServiceFlagPersistent, Timeout: 300, Netmask: int(native.Uint32(net.CIDRMask(24, 32)))}
+
+	sched := "rr"
+	if err := (&ServicePatch{SchedName: &sched}).apply(s); err != nil {
+		t.Fatalf("Failed apply patch %s", err)
+	}
+	got := parseServiceAttr(t, s)
+	if got.SchedName != "rr" || got.Timeout != 300 || got.Flags&ServiceFlagPersistent == 0 ||
+		got.PersistenceNetmask().String() != net.CIDRMask(24, 32).String() {
+		t.Errorf("different service %+v", got)
+	}
+
+	off := time.Duration(0)
+	if err := (&ServicePatch{Persistence: &off}).apply(s); err != nil {
+		t.Fatalf("Failed apply patch %s", err)
+	}
+	got = parseServiceAttr(t, s)
+	if got.Timeout != 0 || got.Flags&ServiceFlagPersistent != 0 || got.SchedName != "rr" {
+		t.Errorf("different service %+v", got)
+	}
+}
+
+func TestServicePatchKeepsPersistenceEngine(t *testing.T) {
+	s := parseServiceAttr(t, &ServiceEntry{Address: "10.0.0.1", Protocol: "UDP", Port: 5060, SchedName: "rr",
+		Flags: ServiceFlagPersistent, Timeout: 300, PEName: "sip"})
+	if s.PEName != "sip" {
+		t.Fatalf("different persistence engine %q", s.PEName)
+	}
+
+	sched := "wlc"
+	if err := (&ServicePatch{SchedName: &sched}).apply(s); err != nil {
+		t.Fatalf("Failed apply patch %s", err)
+	}
+	got := parseServiceAttr(t, s)
+	if got.SchedName != "wlc" || got.PEName != "sip" || got.Timeout != 300 {
+		t.Errorf("different service %+v", got)
+	}
+}
+
+func TestDestinationPatch(t *testing.T) {
+	d := &DestinationEntry{Address: "10.0.0.2", Port: 80, Weight: 5, Method: "TUN", UpperThreshold: 100, TunnelType: "gue", TunnelPort: 6080}
+
+	weight := 0
+	(&DestinationPatch{Weight: &weight}).apply(d)
+	if d.Weight != 0 || d.UpperThreshold != 100 || d.TunnelType != "gue" {
+		t.Errorf("different destination %+v", d)
+	}
+
+	method := "DR"
+	(&DestinationPatch{Method: &method}).apply(d)
+	if d.Method != "DR" || d.TunnelType != "" || d.TunnelPort != 0 {
+		t.Errorf("different destination %+v", d)
+	}
+	if _, err := d.Serialize(); err != nil {
+		t.Errorf("Failed serialize destination %s", err)
+	}
+}
+
+func TestServicePatchFlags(t *testing.T) {
+	s := &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, AddressFamily: "IPv4", SchedName: "sh",
+		Flags: ServiceFlagHashed | ServiceFlagOnePacket}
+	if err := (&ServicePatch{SetFlags: ServiceFlagSHPort}).apply(s); err != nil {
+		t.Fatalf("Failed apply patch %s", err)
+	}
+	flags, mask := serviceFlagsAttr(t, s)
+	if flags&IP_VS_SVC_F_SCHED2 == 0 || mask != IP_VS_SVC_F_SCHED2 {
+		t.Errorf("different flags 0x%x/0x%x", flags, mask)
+	}
+}
@@ -0,0 +1,217 @@
+package libipvs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// PlannedOperation is a change Reconcile would make.
+type PlannedOperation struct {
+	Op          string          `json:"op"` // NEW_SERVICE, SET_SERVICE, DEL_SERVICE, NEW_DEST, SET_DEST or DEL_DEST
+	Service     ServiceKey      `json:"service"`
+	Destination *DestinationKey `json:"destination,omitempty"`
+	Changes     []FieldChange   `json:"changes,omitempty"`
+
+	// Before is nil for additions and After for deletions.
+	Before *PlannedState `json:"before,omitempty"`
+	After  *PlannedState `json:"after,omitempty"`
+}
+
+// PlannedState holds the service of a service operation or the destination
+// of a destination operation.
+type PlannedState struct {
+	Service     *ServiceEntry     `json:"service,omitempty"`
+	Destination *DestinationEntry `json:"destination,omitempty"`
+}
+
+// FieldChange is the old and new value of an attribute of a service or
+// destination, formatted as text.
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// Plan is the ordered list of operations that converges the kernel state
+// to a desired configuration.
+type Plan struct {
+	Operations []PlannedOperation `json:"operations"`
+}
+
+type field struct {
+	name, value string
+}
+
+func (s *ServiceEntry) netmaskString() string {
+	af, err := s.family()
+	if err != nil {
+		return ""
+	}
+	netmask := s.persistenceNetmask(af)
+	if af == syscall.AF_INET6 {
+		return "/" + strconv.Itoa(int(netmask))
+	}
+	mask := make(net.IP, net.IPv4len)
+	native.PutUint32(mask, netmask)
+	return mask.String()
+}
+
+// planFields returns the attributes compared by Reconcile.
+func (s *ServiceEntry) planFields() []field {
+	return []field{
+		{"scheduler", s.SchedName},
+		{"flags", (s.Flags &^ ServiceFlagHashed).Format(s.SchedName)},
+		{"timeout", strconv.Itoa(s.Timeout)},
+		{"netmask", s.netmaskString()},
+		{"pename", s.PEName},
+	}
+}
+
+func (d *DestinationEntry) planFields() []field {
+	method := d.Method
+	var tunnel string
+	if m, err := d.ForwardingMethod(); err == nil {
+		method = m.String()
+		if tun, err := d.tunnel(); m == ForwardTunnel && err == nil {
+			tunnel = tunnelTypeName(tun.tunType)
+			if tun.tunType == IP_VS_CONN_F_TUNNEL_TYPE_GUE {
+				tunnel += ":" + strconv.Itoa(int(tun.port))
+			}
+			if tun.flags != IP_VS_TUNNEL_ENCAP_FLAG_NOCSUM {
+				tunnel += ":" + tunnelChecksumName(tun.flags)
+			}
+		}
+	}
+	return []field{
+		{"weight", strconv.Itoa(d.Weight)},
+		{"method", method},
+		{"upperthreshold", strconv.Itoa(d.UpperThreshold)},
+		{"lowerthreshold", strconv.Itoa(d.LowerThreshold)},
+		{"tunnel", tunnel},
+	}
+}
+
+func fieldChanges(before, after []field) []FieldChange {
+	var changes []FieldChange
+	for i := range before {
+		if before[i].value != after[i].value {
+			changes = append(changes, FieldChange{Field: before[i].name, Before: before[i].value, After: after[i].value})
+		}
+	}
+	return changes
+}
+
+func newFields(fields []field) []FieldChange {
+	var changes []FieldChange
+	for _, f := range fields {
+		if f.value != "" {
+			changes = append(changes, FieldChange{Field: f.name, After: f.value})
+		}
+	}
+	return changes
+}
+
+func plannedOperation(op operation) PlannedOperation {
+	p := PlannedOperation{Op: cmdNames[op.cmd], Service: op.service.Key()}
+	if op.destination != nil {
+		dkey := op.destination.Key()
+		p.Destination = &dkey
+	}
+
+	switch op.cmd {
+	case IPVS_CMD_NEW_SERVICE:
+		p.After = &PlannedState{Service: op.service}
+		p.Changes = newFields(op.service.planFields())
+	case IPVS_CMD_SET_SERVICE:
+		p.Before, p.After = &PlannedState{Service: op.oldService}, &PlannedState{Service: op.service}
+		p.Changes = fieldChanges(op.oldService.planFields(), op.service.planFields())
+	case IPVS_CMD_DEL_SERVICE:
+		p.Before = &PlannedState{Service: op.oldService}
+	case IPVS_CMD_NEW_DEST:
+		p.After = &PlannedState{Destination: op.destination}
+		p.Changes = newFields(op.destination.planFields())
+	case IPVS_CMD_SET_DEST:
+		p.Before, p.After = &PlannedState{Destination: op.oldDestination}, &PlannedState{Destination: op.destination}
+		p.Changes = fieldChanges(op.oldDestination.planFields(), op.destination.planFields())
+	case IPVS_CMD_DEL_DEST:
+		p.Before = &PlannedState{Destination: op.oldDestination}
+	}
+	return p
+}
+
+// Empty reports whether the plan changes nothing.
+func (p *Plan) Empty() bool {
+	return len(p.Operations) == 0
+}
+
+// String renders the plan one operation per line: "+" adds, "~" updates
+// and "-" deletes.
+func (p *Plan) String() string {
+	var b bytes.Buffer
+	for _, op := range p.Operations {
+		var sign, kind string
+		switch op.Op {
+		case "NEW_SERVICE", "NEW_DEST":
+			sign = "+"
+		case "SET_SERVICE", "SET_DEST":
+			sign = "~"
+		default:
+			sign = "-"
+		}
+		kind = "service"
+		target := op.Service.String()
+		if op.Destination != nil {
+			kind = "destination"
+			target += " " + op.Destination.String()
+		}
+		fmt.Fprintf(&b, "%s %s %s", sign, kind, target)
+
+		for _, c := range op.Changes {
+			if sign == "+" {
+				fmt.Fprintf(&b, " %s=%s", c.Field, c.After)
+			} else {
+				fmt.Fprintf(&b, " %s=%q->%q", c.Field, c.Before, c.After)
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// JSON renders the plan as indented JSON.
+func (p *Plan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// Plan returns the operations Reconcile would run to reach desired, without
+// changing the kernel state.
+func (h *IPVSHandler) Plan(desired []*Entry) (*Plan, error) {
+	return h.PlanContext(context.Background(), desired)
+}
+
+func (h *IPVSHandler) PlanContext(ctx context.Context, desired []*Entry) (*Plan, error) {
+	current, err := h.GetAllEntryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return planEntries(current, desired)
+}
+
+func planEntries(current, desired []*Entry) (*Plan, error) {
+	ops, err := diffEntries(current, desired)
+	if err != nil {
+		oe := invalidArgument(0, nil, nil, err)
+		oe.Op = "PLAN"
+		return nil, oe
+	}
+	p := &Plan{Operations: []PlannedOperation{}}
+	for _, op := range ops {
+		p.Operations = append(p.Operations, plannedOperation(op))
+	}
+	return p, nil
+}
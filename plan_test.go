@@ -0,0 +1,69 @@
+package libipvs
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	current := []*Entry{
+		{
+			Service: &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, AddressFamily: "IPv4",
+				SchedName: "wlc", Flags: ServiceFlagHashed, Netmask: 0xFFFFFFFF},
+			Destinations: []*DestinationEntry{
+				{Address: "10.1.0.1", Port: 80, Weight: 1, Method: "DR", AddressFamily: "IPv4"},
+				{Address: "10.1.0.2", Port: 80, Weight: 1, Method: "DR", AddressFamily: "IPv4"},
+			},
+		},
+	}
+	desired := []*Entry{
+		{
+			Service: &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, SchedName: "rr"},
+			Destinations: []*DestinationEntry{
+				{Address: "10.1.0.1", Port: 80, Weight: 5, Method: "DR"},
+				{Address: "10.1.0.3", Port: 80, Weight: 1, Method: "NAT"},
+			},
+		},
+	}
+
+	p, err := planEntries(current, desired)
+	if err != nil {
+		t.Fatalf("Failed plan %s", err)
+	}
+	want := `~ service tcp:10.0.0.1:80 scheduler="wlc"->"rr"
+~ destination tcp:10.0.0.1:80 10.1.0.1:80 weight="1"->"5"
++ destination tcp:10.0.0.1:80 10.1.0.3:80 weight=1 method=NAT upperthreshold=0 lowerthreshold=0
+- destination tcp:10.0.0.1:80 10.1.0.2:80
+`
+	if got := p.String(); got != want {
+		t.Errorf("different plan\n%s\nwant\n%s", got, want)
+	}
+
+	b, err := p.JSON()
+	if err != nil {
+		t.Fatalf("Failed encode plan %s", err)
+	}
+	var decoded Plan
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("Failed decode plan %s", err)
+	}
+	if len(decoded.Operations) != 4 || decoded.Operations[1].Before.Destination.Weight != 1 ||
+		decoded.Operations[1].After.Destination.Weight != 5 || decoded.Operations[3].After != nil {
+		t.Errorf("different decoded plan %s", b)
+	}
+
+	p, err = planEntries(current, current)
+	if err != nil {
+		t.Fatalf("Failed plan %s", err)
+	}
+	if !p.Empty() {
+		t.Errorf("Expected empty plan, got\n%s", p)
+	}
+
+	var oe *OperationError
+	_, err = planEntries(current, append(current, current[0]))
+	if !errors.As(err, &oe) || !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Expected OperationError for duplicate service, got %v", err)
+	}
+}
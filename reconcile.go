@@ -0,0 +1,209 @@
+package libipvs
+
+import (
+	"context"
+	"fmt"
+)
+
+// operation is a change of the kernel state computed by diffEntries.
+type operation struct {
+	cmd         uint8
+	service     *ServiceEntry
+	destination *DestinationEntry
+
+	// state before the change, nil for additions
+	oldService     *ServiceEntry
+	oldDestination *DestinationEntry
+}
+
+// desiredService returns a copy of s to send to the kernel: all flags are
+// set, not only the ones changed by SetFlags and ClearFlags.
+func desiredService(s *ServiceEntry) *ServiceEntry {
+	c := *s
+	c.flagsMask, c.maskFlags = 0, false
+	c.Stats = Stats{}
+	return &c
+}
+
+func desiredDestination(d *DestinationEntry) *DestinationEntry {
+	c := *d
+	c.ActiveConnections, c.InActiveConnections, c.PersistConnections = 0, 0, 0
+	c.Stats = Stats{}
+	return &c
+}
+
+// serviceEqual reports whether the configurable attributes of the services
+// a and b are the same. The hashed flag is kept by the kernel and ignored.
+func serviceEqual(a, b *ServiceEntry) bool {
+	if a.SchedName != b.SchedName || a.PEName != b.PEName || a.Timeout != b.Timeout {
+		return false
+	}
+	if a.Flags&^ServiceFlagHashed != b.Flags&^ServiceFlagHashed {
+		return false
+	}
+	afA, errA := a.family()
+	afB, errB := b.family()
+	if errA != nil || errB != nil {
+		return false
+	}
+	return a.persistenceNetmask(afA) == b.persistenceNetmask(afB)
+}
+
+// destinationEqual reports whether the configurable attributes of the
+// destinations a and b are the same.
+func destinationEqual(a, b *DestinationEntry) bool {
+	if a.Weight != b.Weight || a.UpperThreshold != b.UpperThreshold || a.LowerThreshold != b.LowerThreshold {
+		return false
+	}
+	methodA, errA := a.ForwardingMethod()
+	methodB, errB := b.ForwardingMethod()
+	if errA != nil || errB != nil || methodA != methodB {
+		return false
+	}
+	if methodA != ForwardTunnel {
+		return true
+	}
+	tunA, errA := a.tunnel()
+	tunB, errB := b.tunnel()
+	return errA == nil && errB == nil && *tunA == *tunB
+}
+
+// validateEntries checks that the entries can be sent to the kernel and
+// that no service or destination appears twice.
+func validateEntries(entries []*Entry) error {
+	services := map[ServiceKey]bool{}
+	for _, e := range entries {
+		if e.Service == nil {
+			return fmt.Errorf("entry without service")
+		}
+		key := e.Service.Key()
+		if services[key] {
+			return fmt.Errorf("duplicate service %s", key)
+		}
+		services[key] = true
+		if _, err := e.Service.Serialize(); err != nil {
+			return fmt.Errorf("service %s: %v", key, err)
+		}
+		af, _ := e.Service.family()
+		if err := e.Service.validatePersistence(af); err != nil {
+			return fmt.Errorf("service %s: %v", key, err)
+		}
+
+		destinations := map[DestinationKey]bool{}
+		for _, d := range e.Destinations {
+			dkey := d.Key()
+			if destinations[dkey] {
+				return fmt.Errorf("duplicate destination %s of service %s", dkey, key)
+			}
+			destinations[dkey] = true
+			if _, err := d.Serialize(); err != nil {
+				return fmt.Errorf("destination %s of service %s: %v", dkey, key, err)
+			}
+			if err := d.validateFamily(e.Service); err != nil {
+				return fmt.Errorf("destination %s of service %s: %v", dkey, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// diffEntries returns the operations that turn current into desired, in an
+// order that keeps the services available: services are added and updated
+// first, then destinations are added and updated, and only then obsolete
+// destinations and services are deleted. A service that keeps destinations
+// is therefore never empty in between.
+func diffEntries(current, desired []*Entry) ([]operation, error) {
+	if err := validateEntries(desired); err != nil {
+		return nil, err
+	}
+
+	currentByKey := map[ServiceKey]*Entry{}
+	for _, e := range current {
+		currentByKey[e.Service.Key()] = e
+	}
+	desiredByKey := map[ServiceKey]*Entry{}
+	for _, e := range desired {
+		desiredByKey[e.Service.Key()] = e
+	}
+
+	var services, destinations, deletions []operation
+	for _, want := range desired {
+		si := desiredService(want.Service)
+		have, ok := currentByKey[want.Service.Key()]
+		switch {
+		case !ok:
+			services = append(services, operation{cmd: IPVS_CMD_NEW_SERVICE, service: si})
+		case !serviceEqual(have.Service, want.Service):
+			services = append(services, operation{cmd: IPVS_CMD_SET_SERVICE, service: si, oldService: have.Service})
+		}
+
+		haveDests := map[DestinationKey]*DestinationEntry{}
+		if ok {
+			for _, d := range have.Destinations {
+				haveDests[d.Key()] = d
+			}
+		}
+		wantDests := map[DestinationKey]bool{}
+		for _, d := range want.Destinations {
+			wantDests[d.Key()] = true
+			old, exists := haveDests[d.Key()]
+			switch {
+			case !exists:
+				destinations = append(destinations, operation{cmd: IPVS_CMD_NEW_DEST, service: si,
+					destination: desiredDestination(d)})
+			case !destinationEqual(old, d):
+				destinations = append(destinations, operation{cmd: IPVS_CMD_SET_DEST, service: si,
+					destination: desiredDestination(d), oldService: have.Service, oldDestination: old})
+			}
+		}
+		if ok {
+			for _, d := range have.Destinations {
+				if !wantDests[d.Key()] {
+					deletions = append(deletions, operation{cmd: IPVS_CMD_DEL_DEST, service: have.Service,
+						destination: d, oldService: have.Service, oldDestination: d})
+				}
+			}
+		}
+	}
+
+	// deleting a service deletes its destinations
+	for _, have := range current {
+		if _, ok := desiredByKey[have.Service.Key()]; !ok {
+			deletions = append(deletions, operation{cmd: IPVS_CMD_DEL_SERVICE, service: have.Service,
+				oldService: have.Service})
+		}
+	}
+
+	ops := append(services, destinations...)
+	return append(ops, deletions...), nil
+}
+
+// Reconcile changes the kernel state to desired with the fewest service
+// and destination operations: missing services and destinations are added,
+// the ones whose scheduler, flags, persistence, weight, method, thresholds
+// or tunnel differ are updated and the ones not in desired are deleted.
+// Destinations are added before obsolete ones are deleted. Reconcile stops
+// at the first failing operation, leaving the ones before it applied.
+func (h *IPVSHandler) Reconcile(desired []*Entry) error {
+	return h.ReconcileContext(context.Background(), desired)
+}
+
+func (h *IPVSHandler) ReconcileContext(ctx context.Context, desired []*Entry) error {
+	current, err := h.GetAllEntryContext(ctx)
+	if err != nil {
+		return err
+	}
+	ops, err := diffEntries(current, desired)
+	if err != nil {
+		oe := invalidArgument(0, nil, nil, err)
+		oe.Op = "RECONCILE"
+		return oe
+	}
+
+	for _, op := range ops {
+		if _, err := h.sendRequest(ctx, op.cmd, op.service, op.destination); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package libipvs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffEntries(t *testing.T) {
+	current := []*Entry{
+		{
+			Service: &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, AddressFamily: "IPv4",
+				SchedName: "wlc", Flags: ServiceFlagHashed, Netmask: 0xFFFFFFFF},
+			Destinations: []*DestinationEntry{
+				{Address: "10.1.0.1", Port: 80, Weight: 1, Method: "DR", AddressFamily: "IPv4", ActiveConnections: 10},
+				{Address: "10.1.0.2", Port: 80, Weight: 1, Method: "DR", AddressFamily: "IPv4"},
+			},
+		},
+		{
+			Service:      &ServiceEntry{Address: "10.0.0.2", Protocol: "TCP", Port: 80, AddressFamily: "IPv4", SchedName: "rr"},
+			Destinations: []*DestinationEntry{{Address: "10.1.0.1", Port: 80, Weight: 1, Method: "NAT"}},
+		},
+	}
+	desired := []*Entry{
+		{
+			Service: &ServiceEntry{Address: "10.0.0.1", Protocol: "tcp", Port: 80, SchedName: "wlc"},
+			Destinations: []*DestinationEntry{
+				{Address: "10.1.0.1", Port: 80, Weight: 1, Method: "DR"},
+				{Address: "10.1.0.3", Port: 80, Weight: 1, Method: "DR"},
+			},
+		},
+		{
+			Service:      &ServiceEntry{FWMark: 1, SchedName: "rr"},
+			Destinations: []*DestinationEntry{{Address: "10.1.0.1", Port: 0, Weight: 2, Method: "TUN", TunnelType: "ipip"}},
+		},
+	}
+
+	ops, err := diffEntries(current, desired)
+	if err != nil {
+		t.Fatalf("Failed diff entries %s", err)
+	}
+	var got []string
+	for _, op := range ops {
+		s := cmdNames[op.cmd] + " " + op.service.Key().String()
+		if op.destination != nil {
+			s += " " + op.destination.Key().String()
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"NEW_SERVICE fwmark:1",
+		"NEW_DEST tcp:10.0.0.1:80 10.1.0.3:80",
+		"NEW_DEST fwmark:1 10.1.0.1:0",
+		"DEL_DEST tcp:10.0.0.1:80 10.1.0.2:80",
+		"DEL_SERVICE tcp:10.0.0.2:80",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("different operations\n got %q\nwant %q", got, want)
+	}
+
+	desired[0].Destinations[0].UpperThreshold = 100
+	desired[0].Service.SetFlags(ServiceFlagOnePacket)
+	ops, err = diffEntries(current, desired[:1])
+	if err != nil {
+		t.Fatalf("Failed diff entries %s", err)
+	}
+	if len(ops) != 5 || ops[0].cmd != IPVS_CMD_SET_SERVICE || ops[1].cmd != IPVS_CMD_SET_DEST ||
+		ops[1].oldDestination != current[0].Destinations[0] || ops[2].cmd != IPVS_CMD_NEW_DEST {
+		t.Errorf("different operations %+v", ops)
+	}
+
+	desired = append(desired, &Entry{Service: &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, SchedName: "rr"}})
+	if _, err := diffEntries(current, desired); err == nil {
+		t.Errorf("Expected error for duplicate service")
+	}
+}
@@ -0,0 +1,185 @@
+package libipvs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+var (
+	procModules = "/proc/modules"
+	modulesDir  = "/lib/modules"
+)
+
+// ip_vs_* modules that are neither schedulers nor the core module.
+var nonSchedulerModules = map[string]bool{
+	"ftp":    true, // application helper
+	"pe_sip": true, // persistence engine
+}
+
+// schedulerName returns the scheduler implemented by module, which may be
+// a module name or a path to a module file.
+func schedulerName(module string) (string, bool) {
+	name := filepath.Base(module)
+	if i := strings.Index(name, ".ko"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.Replace(name, "-", "_", -1)
+	if !strings.HasPrefix(name, "ip_vs_") {
+		return "", false
+	}
+	name = strings.TrimPrefix(name, "ip_vs_")
+	if name == "" || nonSchedulerModules[name] {
+		return "", false
+	}
+	return name, true
+}
+
+// AvailableSchedulers returns the names of the schedulers that are loaded,
+// built into the kernel or can be loaded from the module directory of the
+// running kernel. The kernel loads a scheduler module on first use. The
+// list may be incomplete, e.g. in a container without the module directory,
+// so services are only checked against it by handlers created with
+// WithSchedulerCheck; otherwise an unknown scheduler makes the kernel fail
+// the request with ErrSchedulerNotFound.
+func AvailableSchedulers() ([]string, error) {
+	found := map[string]bool{}
+	add := func(module string) {
+		if name, ok := schedulerName(module); ok {
+			found[name] = true
+		}
+	}
+
+	err := readLines(procModules, func(line string) {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			add(fields[0])
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := unameRelease()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(modulesDir, release)
+	err = readLines(filepath.Join(dir, "modules.builtin"), add)
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "kernel/net/netfilter/ipvs/ip_vs_*.ko*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		add(file)
+	}
+
+	schedulers := make([]string, 0, len(found))
+	for name := range found {
+		schedulers = append(schedulers, name)
+	}
+	sort.Strings(schedulers)
+	return schedulers, nil
+}
+
+// readLines calls fn for each line of path. A missing file has no lines.
+func readLines(path string, fn func(string)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fn(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// validSchedulerName checks the syntax of a scheduler name.
+func validSchedulerName(name string) error {
+	if len(name) >= IP_VS_SCHEDNAME_MAXLEN {
+		return fmt.Errorf("scheduler name %s too long", name)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			return fmt.Errorf("invalid scheduler name %s", name)
+		}
+	}
+	return nil
+}
+
+// LoadScheduler loads the module of scheduler name with modprobe.
+func LoadScheduler(name string) error {
+	if name == "" {
+		return fmt.Errorf("invalid scheduler name %s", name)
+	}
+	if err := validSchedulerName(name); err != nil {
+		return err
+	}
+	return loadModule("ip_vs_" + name)
+}
+
+// checkScheduler returns an error matching ErrSchedulerNotFound if the
+// scheduler of si is not among the cached AvailableSchedulers. With
+// WithModuleAutoload a missing scheduler is loaded with LoadScheduler and
+// added to the cache. Nothing is checked if no scheduler was discovered.
+func (h *IPVSHandler) checkScheduler(cmd uint8, si *ServiceEntry) error {
+	if !h.schedCheck || si.SchedName == "" {
+		return nil
+	}
+	h.schedLock.Lock()
+	defer h.schedLock.Unlock()
+
+	if h.schedulers == nil {
+		schedulers, err := AvailableSchedulers()
+		if err != nil {
+			return newOperationError(cmd, si, nil, fmt.Errorf("discover schedulers: %w", err))
+		}
+		h.schedulers = map[string]bool{}
+		for _, name := range schedulers {
+			h.schedulers[name] = true
+		}
+	}
+	if len(h.schedulers) == 0 || h.schedulers[si.SchedName] {
+		return nil
+	}
+
+	oe := newOperationError(cmd, si, nil, ErrSchedulerNotFound)
+	oe.Message = "scheduler " + si.SchedName + " not available"
+	if h.autoload {
+		if err := LoadScheduler(si.SchedName); err != nil {
+			oe.Message += ": " + err.Error()
+			return oe
+		}
+		h.schedulers[si.SchedName] = true
+		return nil
+	}
+	return oe
+}
+
+// unameRelease returns the release of the running kernel, e.g. "5.4.0-42-generic".
+func unameRelease() (string, error) {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return "", err
+	}
+	var b []byte
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return string(b), nil
+}
@@ -0,0 +1,99 @@
+package libipvs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAvailableSchedulers(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "libipvs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	release, err := unameRelease()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipvsDir := filepath.Join(tmp, release, "kernel/net/netfilter/ipvs")
+	if err := os.MkdirAll(ipvsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ip_vs.ko.xz", "ip_vs_mh.ko.xz", "ip_vs_ftp.ko.xz", "ip_vs_pe_sip.ko.xz", "ip_vs_twos.ko"} {
+		if err := ioutil.WriteFile(filepath.Join(ipvsDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	builtin := "kernel/net/netfilter/ipvs/ip_vs_rr.ko\nkernel/net/ipv4/tcp_cubic.ko\n"
+	if err := ioutil.WriteFile(filepath.Join(tmp, release, "modules.builtin"), []byte(builtin), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modules := "ip_vs_wlc 16384 1 - Live 0x0000000000000000\nip_vs 176128 3 ip_vs_wlc, Live 0x0000000000000000\n"
+	if err := ioutil.WriteFile(filepath.Join(tmp, "modules"), []byte(modules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(p, d string) { procModules, modulesDir = p, d }(procModules, modulesDir)
+	procModules, modulesDir = filepath.Join(tmp, "modules"), tmp
+
+	schedulers, err := AvailableSchedulers()
+	if err != nil {
+		t.Fatalf("Failed discover schedulers %s", err)
+	}
+	if want := []string{"mh", "rr", "twos", "wlc"}; !reflect.DeepEqual(schedulers, want) {
+		t.Errorf("different schedulers %v, want %v", schedulers, want)
+	}
+
+	// services are not checked against the discovered schedulers
+	if _, err := (&ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, SchedName: "lblc"}).Serialize(); err != nil {
+		t.Errorf("Failed serialize service %s", err)
+	}
+	for _, name := range []string{"../rr", "averyverylongname"} {
+		if _, err := (&ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, SchedName: name}).Serialize(); err == nil {
+			t.Errorf("Expected error for scheduler %s", name)
+		}
+	}
+}
+
+func TestCheckScheduler(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "libipvs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	modules := "ip_vs_mh 16384 1 - Live 0x0000000000000000\nip_vs 176128 3 ip_vs_mh, Live 0x0000000000000000\n"
+	if err := ioutil.WriteFile(filepath.Join(tmp, "modules"), []byte(modules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p, d string) { procModules, modulesDir = p, d }(procModules, modulesDir)
+	procModules, modulesDir = filepath.Join(tmp, "modules"), tmp
+
+	h := &IPVSHandler{schedCheck: true}
+	s := &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, SchedName: "mh"}
+	if err := h.checkScheduler(IPVS_CMD_NEW_SERVICE, s); err != nil {
+		t.Errorf("Failed check scheduler %s", err)
+	}
+
+	// the list is cached by the handler
+	if err := os.Remove(filepath.Join(tmp, "modules")); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.checkScheduler(IPVS_CMD_SET_SERVICE, s); err != nil {
+		t.Errorf("Failed check cached scheduler %s", err)
+	}
+	s.SchedName = "lblc"
+	if err := h.checkScheduler(IPVS_CMD_SET_SERVICE, s); !errors.Is(err, ErrSchedulerNotFound) {
+		t.Errorf("Expected ErrSchedulerNotFound, got %v", err)
+	}
+
+	// without the option nothing is checked
+	if err := (&IPVSHandler{}).checkScheduler(IPVS_CMD_NEW_SERVICE, s); err != nil {
+		t.Errorf("Failed check scheduler without option %s", err)
+	}
+}
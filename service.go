@@ -0,0 +1,137 @@
+package libipvs
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// ServiceOption sets optional attributes of a service when it is added or
+// updated.
+type ServiceOption func(*ServiceEntry) error
+
+// WithPersistence makes the service persistent: connections of a client are
+// sent to the same destination until timeout has elapsed since the last one.
+func WithPersistence(timeout time.Duration) ServiceOption {
+	return func(s *ServiceEntry) error {
+		if timeout < time.Second {
+			return fmt.Errorf("invalid persistence timeout %v", timeout)
+		}
+		s.SetFlags(ServiceFlagPersistent)
+		s.Timeout = int(timeout / time.Second)
+		return nil
+	}
+}
+
+// WithPersistenceNetmask groups clients for persistence. mask is an IPv4
+// netmask for IPv4 services and an IPv6 mask, e.g. net.CIDRMask(64, 128),
+// for IPv6 services.
+func WithPersistenceNetmask(mask net.IPMask) ServiceOption {
+	return func(s *ServiceEntry) error {
+		ones, bits := mask.Size()
+		switch {
+		case bits == 32:
+			s.Netmask = int(native.Uint32(mask))
+		case bits == 128 && ones > 0:
+			s.Netmask = ones
+		default:
+			return fmt.Errorf("invalid persistence netmask %v", mask)
+		}
+		return nil
+	}
+}
+
+// WithPersistenceEngine selects a persistence engine, such as "sip".
+func WithPersistenceEngine(name string) ServiceOption {
+	return func(s *ServiceEntry) error {
+		s.PEName = name
+		return nil
+	}
+}
+
+// apply sets the options of a service being added or updated. Only the
+// flags named by the options are sent, so the others keep their value on
+// update. Persistence is always described by the options in full: without
+// WithPersistence the persistent flag is cleared along with the timeout.
+func (s *ServiceEntry) apply(opts []ServiceOption) error {
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return err
+		}
+	}
+	s.flagsMask |= ServiceFlagPersistent
+	s.maskFlags = true
+	return nil
+}
+
+// PersistenceNetmask returns the persistence netmask of the service as an
+// IPv4 or IPv6 mask.
+func (s *ServiceEntry) PersistenceNetmask() net.IPMask {
+	if s.AddressFamily == "IPv6" {
+		return net.CIDRMask(s.Netmask, 128)
+	}
+	mask := make(net.IPMask, net.IPv4len)
+	native.PutUint32(mask, uint32(s.Netmask))
+	return mask
+}
+
+// validatePersistence checks that the persistence settings of s are
+// coherent for a service of family af. It is only run before a service is
+// added or updated, so services created by other tools can still be read
+// and deleted. When the persistent flag is masked out its current value is
+// unknown and the checks depending on it are skipped.
+func (s *ServiceEntry) validatePersistence(af uint16) error {
+	persistent := s.Flags&ServiceFlagPersistent != 0
+	known := !s.maskFlags || s.flagsMask&ServiceFlagPersistent != 0
+
+	if s.Timeout < 0 {
+		return fmt.Errorf("invalid persistence timeout %d", s.Timeout)
+	}
+	if known && persistent && s.Timeout == 0 {
+		return fmt.Errorf("persistent service without persistence timeout")
+	}
+	if s.PEName != "" {
+		if known && !persistent {
+			return fmt.Errorf("persistence engine %s requires a persistent service", s.PEName)
+		}
+		if len(s.PEName) >= IP_VS_PENAME_MAXLEN {
+			return fmt.Errorf("invalid persistence engine name %s", s.PEName)
+		}
+	}
+
+	netmask := s.persistenceNetmask(af)
+	switch af {
+	case syscall.AF_INET:
+		mask := make(net.IPMask, net.IPv4len)
+		native.PutUint32(mask, netmask)
+		if _, bits := mask.Size(); bits == 0 {
+			return fmt.Errorf("invalid IPv4 persistence netmask %v", net.IP(mask))
+		}
+		if known && !persistent && netmask != 0xFFFFFFFF {
+			return fmt.Errorf("persistence netmask requires a persistent service")
+		}
+	case syscall.AF_INET6:
+		if netmask < 1 || netmask > 128 {
+			return fmt.Errorf("invalid IPv6 persistence prefix length %d", s.Netmask)
+		}
+		if known && !persistent && netmask != 128 {
+			return fmt.Errorf("persistence netmask requires a persistent service")
+		}
+	}
+	return nil
+}
+
+// persistenceNetmask returns the netmask to send for a service of family af.
+// The kernel wants a raw netmask for IPv4 and a prefix length for IPv6.
+func (s *ServiceEntry) persistenceNetmask(af uint16) uint32 {
+	if s.Netmask == 0 {
+		switch af {
+		case syscall.AF_INET:
+			return 0xFFFFFFFF
+		case syscall.AF_INET6:
+			return 128
+		}
+	}
+	return uint32(s.Netmask)
+}
@@ -0,0 +1,214 @@
+package libipvs
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SnapshotFormat and SnapshotVersion identify the encoding of a Snapshot.
+// The version is increased when the meaning of a field changes.
+const (
+	SnapshotFormat  = "libipvs-snapshot"
+	SnapshotVersion = 1
+)
+
+// Snapshot is the whole IPVS state of a network namespace. It is meant to
+// be stored as JSON and given back to Restore.
+type Snapshot struct {
+	Format      string        `json:"format"`
+	Version     int           `json:"version"`
+	Created     time.Time     `json:"created"`
+	IPVSVersion IPVSVersion   `json:"ipvsversion"`
+	Entries     []*Entry      `json:"entries"`
+	Timeouts    *Timeouts     `json:"timeouts,omitempty"`
+	SyncDaemons []*SyncDaemon `json:"syncdaemons,omitempty"`
+}
+
+// RestoreMode tells Restore what to do with the state not in the snapshot.
+type RestoreMode int
+
+const (
+	// RestoreReplace deletes the services, destinations and sync daemons
+	// that are not in the snapshot.
+	RestoreReplace RestoreMode = iota
+	// RestoreMerge keeps them; the snapshot wins where both have an entry.
+	RestoreMerge
+)
+
+// Snapshot returns the current services with their destinations, the
+// timeouts and the sync daemons.
+func (h *IPVSHandler) Snapshot() (*Snapshot, error) {
+	return h.SnapshotContext(context.Background())
+}
+
+func (h *IPVSHandler) SnapshotContext(ctx context.Context) (*Snapshot, error) {
+	info, err := h.InfoContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := h.GetAllEntryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	timeouts, err := h.GetTimeoutsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	daemons, err := h.GetSyncDaemonsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if entries == nil {
+		entries = []*Entry{}
+	}
+	return &Snapshot{
+		Format:      SnapshotFormat,
+		Version:     SnapshotVersion,
+		Created:     time.Now().UTC(),
+		IPVSVersion: info.Version,
+		Entries:     entries,
+		Timeouts:    timeouts,
+		SyncDaemons: daemons,
+	}, nil
+}
+
+func (s *Snapshot) validate() error {
+	if s.Format != SnapshotFormat {
+		return fmt.Errorf("not support snapshot format %q", s.Format)
+	}
+	if s.Version < 1 || s.Version > SnapshotVersion {
+		return fmt.Errorf("not support snapshot version %d", s.Version)
+	}
+	for _, e := range s.Entries {
+		if e == nil || e.Service == nil {
+			return fmt.Errorf("snapshot entry without service")
+		}
+	}
+	return nil
+}
+
+// mergeEntries returns current with the services and destinations of
+// snapshot added or replacing the ones with the same key.
+func mergeEntries(current, snapshot []*Entry) []*Entry {
+	merged := make([]*Entry, 0, len(current)+len(snapshot))
+	byKey := map[ServiceKey]*Entry{}
+	for _, e := range current {
+		c := &Entry{Service: e.Service, Destinations: append([]*DestinationEntry(nil), e.Destinations...)}
+		byKey[e.Service.Key()] = c
+		merged = append(merged, c)
+	}
+
+	for _, e := range snapshot {
+		c, ok := byKey[e.Service.Key()]
+		if !ok {
+			merged = append(merged, e)
+			continue
+		}
+		c.Service = e.Service
+		for _, d := range e.Destinations {
+			replaced := false
+			for i, old := range c.Destinations {
+				if old.Key() == d.Key() {
+					c.Destinations[i], replaced = d, true
+					break
+				}
+			}
+			if !replaced {
+				c.Destinations = append(c.Destinations, d)
+			}
+		}
+	}
+	return merged
+}
+
+// Restore brings back the state of s. The services and destinations are
+// changed in a Transaction, so a failure leaves them as they were; the
+// timeouts and sync daemons are restored afterwards.
+func (h *IPVSHandler) Restore(s *Snapshot, mode RestoreMode) error {
+	return h.RestoreContext(context.Background(), s, mode)
+}
+
+func (h *IPVSHandler) RestoreContext(ctx context.Context, s *Snapshot, mode RestoreMode) error {
+	if err := s.validate(); err != nil {
+		return restoreError(err)
+	}
+	if mode != RestoreReplace && mode != RestoreMerge {
+		return restoreError(fmt.Errorf("not support restore mode %d", mode))
+	}
+
+	current, err := h.GetAllEntryContext(ctx)
+	if err != nil {
+		return err
+	}
+	desired := s.Entries
+	if mode == RestoreMerge {
+		desired = mergeEntries(current, s.Entries)
+	}
+	ops, err := diffEntries(current, desired)
+	if err != nil {
+		return restoreError(err)
+	}
+
+	tx := h.Begin()
+	for _, op := range ops {
+		if err := tx.apply(ctx, op); err != nil {
+			return err
+		}
+	}
+	tx.Commit()
+
+	if s.Timeouts != nil {
+		if err := h.SetTimeoutsContext(ctx, *s.Timeouts); err != nil {
+			return err
+		}
+	}
+	return h.restoreSyncDaemons(ctx, s.SyncDaemons, mode)
+}
+
+func (h *IPVSHandler) restoreSyncDaemons(ctx context.Context, daemons []*SyncDaemon, mode RestoreMode) error {
+	running, err := h.GetSyncDaemonsContext(ctx)
+	if err != nil {
+		return err
+	}
+	byState := map[string]*SyncDaemon{}
+	for _, d := range running {
+		byState[d.State] = d
+	}
+
+	wanted := map[string]bool{}
+	for _, d := range daemons {
+		wanted[d.State] = true
+		if old, ok := byState[d.State]; ok {
+			if *old == *d {
+				continue
+			}
+			if err := h.StopSyncDaemonContext(ctx, d.State); err != nil {
+				return err
+			}
+		}
+		if err := h.StartSyncDaemonContext(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	if mode == RestoreReplace {
+		for _, d := range running {
+			if !wanted[d.State] {
+				if err := h.StopSyncDaemonContext(ctx, d.State); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// restoreError returns an error matching ErrInvalidArgument for a snapshot
+// that cannot be restored.
+func restoreError(err error) *OperationError {
+	oe := invalidArgument(0, nil, nil, err)
+	oe.Op = "RESTORE"
+	return oe
+}
@@ -0,0 +1,80 @@
+package libipvs
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotJSON(t *testing.T) {
+	s := &Snapshot{
+		Format:  SnapshotFormat,
+		Version: SnapshotVersion,
+		Entries: []*Entry{{
+			Service: &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, SchedName: "wlc", Stats: Stats{Connections: 1}},
+			Destinations: []*DestinationEntry{
+				{Address: "10.1.0.1", Port: 80, Weight: 1, Method: "TUN", UpperThreshold: 100, TunnelType: "gue", TunnelPort: 6080},
+			},
+		}},
+		Timeouts:    &Timeouts{TCP: 900 * time.Second},
+		SyncDaemons: []*SyncDaemon{{State: "master", MulticastInterface: "eth0", SyncID: 1}},
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Failed encode snapshot %s", err)
+	}
+	for _, name := range []string{`"format":"libipvs-snapshot"`, `"upperthreshold":100`, `"stats":{"conns":1`, `"tuntype":"gue"`} {
+		if !strings.Contains(string(b), name) {
+			t.Errorf("Expected %s in %s", name, b)
+		}
+	}
+
+	var decoded Snapshot
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("Failed decode snapshot %s", err)
+	}
+	if !reflect.DeepEqual(&decoded, s) {
+		t.Errorf("different snapshot %+v", decoded)
+	}
+	if err := decoded.validate(); err != nil {
+		t.Errorf("Failed validate snapshot %s", err)
+	}
+	decoded.Version = SnapshotVersion + 1
+	if err := decoded.validate(); err == nil {
+		t.Errorf("Expected error for future snapshot version")
+	}
+	var oe *OperationError
+	if err := (&IPVSHandler{}).Restore(&decoded, RestoreReplace); !errors.As(err, &oe) || !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Expected OperationError for future snapshot version, got %v", err)
+	}
+}
+
+func TestMergeEntries(t *testing.T) {
+	current := []*Entry{{
+		Service: &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, SchedName: "wlc"},
+		Destinations: []*DestinationEntry{
+			{Address: "10.1.0.1", Port: 80, Weight: 1, Method: "DR"},
+			{Address: "10.1.0.2", Port: 80, Weight: 1, Method: "DR"},
+		},
+	}}
+	snapshot := []*Entry{
+		{
+			Service:      &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, SchedName: "rr"},
+			Destinations: []*DestinationEntry{{Address: "10.1.0.2", Port: 80, Weight: 5, Method: "DR"}},
+		},
+		{Service: &ServiceEntry{FWMark: 1, SchedName: "rr"}},
+	}
+
+	merged := mergeEntries(current, snapshot)
+	if len(merged) != 2 || merged[0].Service.SchedName != "rr" || len(merged[0].Destinations) != 2 ||
+		merged[0].Destinations[1].Weight != 5 || merged[1].Service.FWMark != 1 {
+		t.Errorf("different merged entries %+v", merged)
+	}
+	if len(current[0].Destinations) != 2 || current[0].Destinations[1].Weight != 1 {
+		t.Errorf("Failed keep current entries %+v", current[0].Destinations)
+	}
+}
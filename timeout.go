@@ -0,0 +1,99 @@
+package libipvs
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+// Timeouts holds the global IPVS connection timeouts. The kernel works in
+// seconds. Zero fields are left unchanged by SetTimeouts.
+type Timeouts struct {
+	TCP    time.Duration `json:"tcp"`
+	TCPFin time.Duration `json:"tcpfin"`
+	UDP    time.Duration `json:"udp"`
+}
+
+func (t *Timeouts) Serialize() ([]nl.NetlinkRequestData, error) {
+	var data []nl.NetlinkRequestData
+	for _, timeout := range []struct {
+		attrType int
+		value    time.Duration
+	}{
+		{IPVS_CMD_ATTR_TIMEOUT_TCP, t.TCP},
+		{IPVS_CMD_ATTR_TIMEOUT_TCP_FIN, t.TCPFin},
+		{IPVS_CMD_ATTR_TIMEOUT_UDP, t.UDP},
+	} {
+		if timeout.value == 0 {
+			continue
+		}
+		secs := timeout.value / time.Second
+		if timeout.value < 0 || secs == 0 {
+			return nil, fmt.Errorf("invalid timeout %v", timeout.value)
+		}
+		data = append(data, nl.NewRtAttr(timeout.attrType, nl.Uint32Attr(uint32(secs))))
+	}
+	return data, nil
+}
+
+func assembleTimeouts(attrs []syscall.NetlinkRouteAttr) *Timeouts {
+	var t Timeouts
+
+	for _, attr := range attrs {
+		value := time.Duration(native.Uint32(attr.Value)) * time.Second
+
+		switch int(attr.Attr.Type) {
+		case IPVS_CMD_ATTR_TIMEOUT_TCP:
+			t.TCP = value
+		case IPVS_CMD_ATTR_TIMEOUT_TCP_FIN:
+			t.TCPFin = value
+		case IPVS_CMD_ATTR_TIMEOUT_UDP:
+			t.UDP = value
+		}
+	}
+	return &t
+}
+
+// GetTimeouts returns the global TCP, TCP FIN_WAIT and UDP timeouts.
+func (h *IPVSHandler) GetTimeouts() (*Timeouts, error) {
+	return h.GetTimeoutsContext(context.Background())
+}
+
+func (h *IPVSHandler) GetTimeoutsContext(ctx context.Context) (*Timeouts, error) {
+	cmd := IPVS_CMD_GET_TIMEOUT
+	msgs, err := h.request(ctx, cmd, syscall.NLM_F_ACK)
+	if err != nil {
+		return nil, wrapError(cmd, nil, nil, err)
+	}
+	if len(msgs) != 1 {
+		return nil, fmt.Errorf("invalid response for IPVS_CMD_GET_TIMEOUT")
+	}
+
+	attrs, err := nl.ParseRouteAttr(msgs[0][nl.SizeofGenlmsg:])
+	if err != nil {
+		return nil, err
+	}
+	return assembleTimeouts(attrs), nil
+}
+
+// SetTimeouts updates the non-zero timeouts of t.
+func (h *IPVSHandler) SetTimeouts(t Timeouts) error {
+	return h.SetTimeoutsContext(context.Background(), t)
+}
+
+func (h *IPVSHandler) SetTimeoutsContext(ctx context.Context, t Timeouts) error {
+	cmd := IPVS_CMD_SET_TIMEOUT
+	data, err := t.Serialize()
+	if err != nil {
+		return invalidArgument(cmd, nil, nil, err)
+	}
+
+	_, err = h.request(ctx, cmd, syscall.NLM_F_ACK, data...)
+	if err != nil {
+		return wrapError(cmd, nil, nil, err)
+	}
+	return nil
+}
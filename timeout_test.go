@@ -0,0 +1,51 @@
+package libipvs
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+func TestTimeoutsSerialize(t *testing.T) {
+	timeouts := Timeouts{TCP: 900 * time.Second, UDP: 300 * time.Second}
+	data, err := timeouts.Serialize()
+	if err != nil {
+		t.Fatalf("Failed serialize timeouts %s", err)
+	}
+	if len(data) != 2 {
+		t.Fatalf("different number of attributes %d, zero timeouts must be skipped", len(data))
+	}
+
+	var b []byte
+	for _, d := range data {
+		b = append(b, d.Serialize()...)
+	}
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		t.Fatalf("Failed parse timeouts %s", err)
+	}
+	for _, attr := range attrs {
+		if int(attr.Attr.Type) == IPVS_CMD_ATTR_TIMEOUT_TCP && native.Uint32(attr.Value) != 900 {
+			t.Errorf("different TCP timeout %d seconds", native.Uint32(attr.Value))
+		}
+	}
+	got := assembleTimeouts(attrs)
+	if *got != timeouts {
+		t.Errorf("different timeouts %+v, expected %+v", got, timeouts)
+	}
+
+	for _, invalid := range []Timeouts{{TCP: -time.Second}, {TCPFin: 500 * time.Millisecond}} {
+		if _, err := invalid.Serialize(); err == nil {
+			t.Errorf("invalid timeouts %+v accepted", invalid)
+		}
+	}
+
+	attrs = []syscall.NetlinkRouteAttr{
+		{Attr: syscall.RtAttr{Type: uint16(IPVS_CMD_ATTR_TIMEOUT_TCP_FIN)}, Value: nl.Uint32Attr(120)},
+	}
+	if got := assembleTimeouts(attrs); got.TCPFin != 120*time.Second || got.TCP != 0 || got.UDP != 0 {
+		t.Errorf("different timeouts %+v", got)
+	}
+}
@@ -0,0 +1,319 @@
+package libipvs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errTransactionDone = errors.New("transaction already committed or rolled back")
+
+// Transaction applies service and destination changes one by one and
+// records the inverse of each, captured from the state before the change,
+// so that all of them can be undone. When a change fails the ones already
+// applied are rolled back and a *TransactionError is returned.
+type Transaction struct {
+	h     *IPVSHandler
+	steps []txStep
+	done  bool
+}
+
+type txStep struct {
+	op      operation
+	inverse []operation
+}
+
+func (op operation) String() string {
+	s := cmdNames[op.cmd] + " " + op.service.Key().String()
+	if op.destination != nil {
+		s += " " + op.destination.Key().String()
+	}
+	return s
+}
+
+// RollbackResult is the outcome of one inverse operation.
+type RollbackResult struct {
+	Op  string
+	Err error
+}
+
+// TransactionError is returned when a step of a transaction fails.
+type TransactionError struct {
+	Step     int    // 1-based number of the failed step
+	Op       string // e.g. "NEW_DEST tcp:10.0.0.1:80 10.1.0.1:80"
+	Err      error
+	Rollback []RollbackResult // in the order they were run
+}
+
+func (e *TransactionError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "transaction step %d %s: %v", e.Step, e.Op, e.Err)
+	failed := 0
+	for _, r := range e.Rollback {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(&b, "; rollback %s: %v", r.Op, r.Err)
+		}
+	}
+	if failed == 0 {
+		fmt.Fprintf(&b, "; rolled back %d operations", len(e.Rollback))
+	}
+	return b.String()
+}
+
+func (e *TransactionError) Unwrap() error {
+	return e.Err
+}
+
+// RolledBack reports whether every applied step was undone.
+func (e *TransactionError) RolledBack() bool {
+	for _, r := range e.Rollback {
+		if r.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Begin starts a transaction.
+func (h *IPVSHandler) Begin() *Transaction {
+	return &Transaction{h: h}
+}
+
+func (t *Transaction) run(ctx context.Context, op operation, inverse []operation) error {
+	if t.done {
+		return errTransactionDone
+	}
+	if _, err := t.h.sendRequest(ctx, op.cmd, op.service, op.destination); err != nil {
+		var oe *OperationError
+		if errors.As(err, &oe) && oe.applied {
+			return t.fail(op, err, inverse...)
+		}
+		return t.fail(op, err)
+	}
+	t.steps = append(t.steps, txStep{op: op, inverse: inverse})
+	return nil
+}
+
+// fail rolls back the transaction after op failed with err. undo is the
+// inverse of op when its change stayed in the kernel anyway; it is run
+// first. The rollback uses its own context because the one of the failed
+// step may be done.
+func (t *Transaction) fail(op operation, err error, undo ...operation) error {
+	step := len(t.steps) + 1
+	if len(undo) > 0 {
+		t.steps = append(t.steps, txStep{op: op, inverse: undo})
+	}
+	return &TransactionError{
+		Step:     step,
+		Op:       op.String(),
+		Err:      err,
+		Rollback: t.rollback(context.Background()),
+	}
+}
+
+// rollback undoes the applied steps in reverse order. It goes on after a
+// failed inverse operation, leaving as little half-applied state as
+// possible.
+func (t *Transaction) rollback(ctx context.Context) []RollbackResult {
+	var results []RollbackResult
+	for i := len(t.steps) - 1; i >= 0; i-- {
+		for _, op := range t.steps[i].inverse {
+			_, err := t.h.sendRequest(ctx, op.cmd, op.service, op.destination)
+			results = append(results, RollbackResult{Op: op.String(), Err: err})
+		}
+	}
+	t.steps = nil
+	t.done = true
+	return results
+}
+
+// Commit ends the transaction, keeping the changes.
+func (t *Transaction) Commit() error {
+	if t.done {
+		return errTransactionDone
+	}
+	t.steps = nil
+	t.done = true
+	return nil
+}
+
+// RollbackError is returned by Rollback when inverse operations failed.
+type RollbackError struct {
+	Results []RollbackResult
+}
+
+func (e *RollbackError) Error() string {
+	var msgs []string
+	for _, r := range e.Results {
+		if r.Err != nil {
+			msgs = append(msgs, fmt.Sprintf("rollback %s: %v", r.Op, r.Err))
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Rollback undoes all the changes of the transaction.
+func (t *Transaction) Rollback() error {
+	return t.RollbackContext(context.Background())
+}
+
+func (t *Transaction) RollbackContext(ctx context.Context) error {
+	if t.done {
+		return errTransactionDone
+	}
+	results := t.rollback(ctx)
+	for _, r := range results {
+		if r.Err != nil {
+			return &RollbackError{Results: results}
+		}
+	}
+	return nil
+}
+
+// apply runs an operation computed by diffEntries.
+func (t *Transaction) apply(ctx context.Context, op operation) error {
+	key := op.service.Key()
+	switch op.cmd {
+	case IPVS_CMD_NEW_SERVICE:
+		return t.AddServiceContext(ctx, op.service)
+	case IPVS_CMD_SET_SERVICE:
+		return t.UpdateServiceContext(ctx, op.service)
+	case IPVS_CMD_DEL_SERVICE:
+		return t.DeleteServiceContext(ctx, key)
+	case IPVS_CMD_NEW_DEST:
+		return t.AddDestinationContext(ctx, key, op.destination)
+	case IPVS_CMD_SET_DEST:
+		return t.UpdateDestinationContext(ctx, key, op.destination)
+	case IPVS_CMD_DEL_DEST:
+		return t.DeleteDestinationContext(ctx, key, op.destination.Key())
+	}
+	return fmt.Errorf("not support command %d", op.cmd)
+}
+
+// AddService adds the service si.
+func (t *Transaction) AddService(si *ServiceEntry) error {
+	return t.AddServiceContext(context.Background(), si)
+}
+
+func (t *Transaction) AddServiceContext(ctx context.Context, si *ServiceEntry) error {
+	op := operation{cmd: IPVS_CMD_NEW_SERVICE, service: si}
+	inverse := operation{cmd: IPVS_CMD_DEL_SERVICE, service: si.Key().entry()}
+	return t.run(ctx, op, []operation{inverse})
+}
+
+// UpdateService replaces the attributes of the service si.
+func (t *Transaction) UpdateService(si *ServiceEntry) error {
+	return t.UpdateServiceContext(context.Background(), si)
+}
+
+func (t *Transaction) UpdateServiceContext(ctx context.Context, si *ServiceEntry) error {
+	op := operation{cmd: IPVS_CMD_SET_SERVICE, service: si}
+	if t.done {
+		return errTransactionDone
+	}
+	old, err := t.h.getService(ctx, si.Key())
+	if err != nil {
+		return t.fail(op, err)
+	}
+	inverse := operation{cmd: IPVS_CMD_SET_SERVICE, service: desiredService(old)}
+	return t.run(ctx, op, []operation{inverse})
+}
+
+// DeleteService deletes the service key with its destinations.
+func (t *Transaction) DeleteService(key ServiceKey) error {
+	return t.DeleteServiceContext(context.Background(), key)
+}
+
+func (t *Transaction) DeleteServiceContext(ctx context.Context, key ServiceKey) error {
+	op := operation{cmd: IPVS_CMD_DEL_SERVICE, service: key.entry()}
+	if t.done {
+		return errTransactionDone
+	}
+	old, err := t.h.getService(ctx, key)
+	if err != nil {
+		return t.fail(op, err)
+	}
+	destinations, err := t.h.GetDestinationsContext(ctx, old)
+	if err != nil {
+		return t.fail(op, err)
+	}
+
+	op.service = old
+	si := desiredService(old)
+	inverse := []operation{{cmd: IPVS_CMD_NEW_SERVICE, service: si}}
+	for _, d := range destinations {
+		inverse = append(inverse, operation{cmd: IPVS_CMD_NEW_DEST, service: si, destination: desiredDestination(d)})
+	}
+	return t.run(ctx, op, inverse)
+}
+
+// AddDestination adds the destination di to the service key.
+func (t *Transaction) AddDestination(key ServiceKey, di *DestinationEntry) error {
+	return t.AddDestinationContext(context.Background(), key, di)
+}
+
+func (t *Transaction) AddDestinationContext(ctx context.Context, key ServiceKey, di *DestinationEntry) error {
+	op := operation{cmd: IPVS_CMD_NEW_DEST, service: key.entry(), destination: di}
+	if t.done {
+		return errTransactionDone
+	}
+	si, err := t.h.getService(ctx, key)
+	if err != nil {
+		return t.fail(op, err)
+	}
+
+	op.service = si
+	inverse := operation{cmd: IPVS_CMD_DEL_DEST, service: si, destination: di}
+	return t.run(ctx, op, []operation{inverse})
+}
+
+// UpdateDestination replaces the attributes of the destination di of the
+// service key.
+func (t *Transaction) UpdateDestination(key ServiceKey, di *DestinationEntry) error {
+	return t.UpdateDestinationContext(context.Background(), key, di)
+}
+
+func (t *Transaction) UpdateDestinationContext(ctx context.Context, key ServiceKey, di *DestinationEntry) error {
+	op := operation{cmd: IPVS_CMD_SET_DEST, service: key.entry(), destination: di}
+	if t.done {
+		return errTransactionDone
+	}
+	si, err := t.h.getService(ctx, key)
+	if err != nil {
+		return t.fail(op, err)
+	}
+	old, err := t.h.GetDestinationContext(ctx, si, di.Address, di.Port)
+	if err != nil {
+		return t.fail(op, err)
+	}
+
+	op.service = si
+	inverse := operation{cmd: IPVS_CMD_SET_DEST, service: si, destination: desiredDestination(old)}
+	return t.run(ctx, op, []operation{inverse})
+}
+
+// DeleteDestination deletes the destination dkey of the service key.
+func (t *Transaction) DeleteDestination(key ServiceKey, dkey DestinationKey) error {
+	return t.DeleteDestinationContext(context.Background(), key, dkey)
+}
+
+func (t *Transaction) DeleteDestinationContext(ctx context.Context, key ServiceKey, dkey DestinationKey) error {
+	op := operation{cmd: IPVS_CMD_DEL_DEST, service: key.entry(), destination: &DestinationEntry{Address: dkey.Address, Port: dkey.Port}}
+	if t.done {
+		return errTransactionDone
+	}
+	si, err := t.h.getService(ctx, key)
+	if err != nil {
+		return t.fail(op, err)
+	}
+	old, err := t.h.GetDestinationContext(ctx, si, dkey.Address, dkey.Port)
+	if err != nil {
+		return t.fail(op, err)
+	}
+
+	op.service, op.destination = si, old
+	inverse := operation{cmd: IPVS_CMD_NEW_DEST, service: si, destination: desiredDestination(old)}
+	return t.run(ctx, op, []operation{inverse})
+}
@@ -0,0 +1,59 @@
+package libipvs
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestTransactionError(t *testing.T) {
+	e := &TransactionError{
+		Step: 3,
+		Op:   "NEW_DEST tcp:10.0.0.1:80 10.1.0.3:80",
+		Err:  ErrDestinationExists,
+		Rollback: []RollbackResult{
+			{Op: "DEL_DEST tcp:10.0.0.1:80 10.1.0.2:80"},
+			{Op: "DEL_SERVICE tcp:10.0.0.1:80", Err: syscall.EBUSY},
+		},
+	}
+	if !errors.Is(e, ErrDestinationExists) {
+		t.Errorf("Expected to match %v", ErrDestinationExists)
+	}
+	if e.RolledBack() {
+		t.Errorf("Expected failed rollback")
+	}
+	if msg := e.Error(); !strings.Contains(msg, "step 3 NEW_DEST") || !strings.Contains(msg, "rollback DEL_SERVICE tcp:10.0.0.1:80") {
+		t.Errorf("different message %s", msg)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	ipvsHandler, err := NewIPVSHandler()
+	if err != nil {
+		t.Fatalf("Failed create IPVSHandler %s", err)
+	}
+
+	key := ServiceKey{Address: "127.1.1.3", Port: 8888, Protocol: "TCP"}
+	tx := ipvsHandler.Begin()
+	if err := tx.AddService(&ServiceEntry{Address: key.Address, Port: key.Port, Protocol: key.Protocol, SchedName: "wlc"}); err != nil {
+		t.Fatalf("Failed add service %s", err)
+	}
+	d := &DestinationEntry{Address: "127.2.1.1", Port: 8888, Weight: 1, Method: "DR"}
+	if err := tx.AddDestination(key, d); err != nil {
+		t.Fatalf("Failed add destination %s", err)
+	}
+
+	err = tx.AddDestination(key, d)
+	var te *TransactionError
+	if !errors.As(err, &te) || te.Step != 3 || !errors.Is(err, ErrDestinationExists) || !te.RolledBack() {
+		t.Fatalf("Expected rolled back TransactionError, got %v", err)
+	}
+	registered, err := ipvsHandler.IsRegisteredService(key.Address, key.Port, key.Protocol)
+	if err != nil {
+		t.Fatalf("Failed IsRegisteredService %s", err)
+	}
+	if registered {
+		t.Errorf("Failed roll back service")
+	}
+}
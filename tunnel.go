@@ -0,0 +1,205 @@
+package libipvs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// WithTunnel sets the encapsulation of a TUN destination. tunType is "ipip",
+// "gue" or "gre", port the destination UDP port of GUE (0 otherwise) and
+// checksum "nocsum", "csum" or "remcsum" ("" means "nocsum").
+func WithTunnel(tunType string, port int, checksum string) DestinationOption {
+	return func(d *DestinationEntry) error {
+		d.TunnelType = tunType
+		d.TunnelPort = port
+		d.TunnelChecksum = checksum
+		return nil
+	}
+}
+
+type tunnelConfig struct {
+	tunType uint8
+	port    uint16
+	flags   uint16
+}
+
+func (d *DestinationEntry) hasTunnelOptions() bool {
+	return d.TunnelType != "" || d.TunnelPort != 0 || d.TunnelChecksum != ""
+}
+
+// tunnel validates the tunnel options of d.
+func (d *DestinationEntry) tunnel() (*tunnelConfig, error) {
+	var tun tunnelConfig
+
+	switch strings.ToLower(d.TunnelType) {
+	case "", "ipip":
+		tun.tunType = IP_VS_CONN_F_TUNNEL_TYPE_IPIP
+	case "gue":
+		tun.tunType = IP_VS_CONN_F_TUNNEL_TYPE_GUE
+	case "gre":
+		tun.tunType = IP_VS_CONN_F_TUNNEL_TYPE_GRE
+	default:
+		return nil, fmt.Errorf("not support tunnel type %s", d.TunnelType)
+	}
+
+	switch strings.ToLower(d.TunnelChecksum) {
+	case "", "nocsum":
+		tun.flags = IP_VS_TUNNEL_ENCAP_FLAG_NOCSUM
+	case "csum":
+		tun.flags = IP_VS_TUNNEL_ENCAP_FLAG_CSUM
+	case "remcsum":
+		tun.flags = IP_VS_TUNNEL_ENCAP_FLAG_REMCSUM
+	default:
+		return nil, fmt.Errorf("not support tunnel checksum %s", d.TunnelChecksum)
+	}
+
+	switch tun.tunType {
+	case IP_VS_CONN_F_TUNNEL_TYPE_GUE:
+		if d.TunnelPort <= 0 || d.TunnelPort > 0xFFFF {
+			return nil, fmt.Errorf("invalid GUE tunnel port %d", d.TunnelPort)
+		}
+		tun.port = uint16(d.TunnelPort)
+	case IP_VS_CONN_F_TUNNEL_TYPE_IPIP:
+		if d.TunnelPort != 0 || tun.flags != IP_VS_TUNNEL_ENCAP_FLAG_NOCSUM {
+			return nil, fmt.Errorf("IPIP tunnels take neither port nor checksum options")
+		}
+	case IP_VS_CONN_F_TUNNEL_TYPE_GRE:
+		if d.TunnelPort != 0 {
+			return nil, fmt.Errorf("GRE tunnels take no port")
+		}
+		if tun.flags == IP_VS_TUNNEL_ENCAP_FLAG_REMCSUM {
+			return nil, fmt.Errorf("GRE tunnels do not support remcsum")
+		}
+	}
+	return &tun, nil
+}
+
+func tunnelTypeName(t uint8) string {
+	switch t {
+	case IP_VS_CONN_F_TUNNEL_TYPE_IPIP:
+		return "ipip"
+	case IP_VS_CONN_F_TUNNEL_TYPE_GUE:
+		return "gue"
+	case IP_VS_CONN_F_TUNNEL_TYPE_GRE:
+		return "gre"
+	}
+	return fmt.Sprintf("unknown(%d)", t)
+}
+
+func tunnelChecksumName(f uint16) string {
+	switch f {
+	case IP_VS_TUNNEL_ENCAP_FLAG_NOCSUM:
+		return "nocsum"
+	case IP_VS_TUNNEL_ENCAP_FLAG_CSUM:
+		return "csum"
+	case IP_VS_TUNNEL_ENCAP_FLAG_REMCSUM:
+		return "remcsum"
+	}
+	return fmt.Sprintf("unknown(%d)", f)
+}
+
+// Tunnel attributes supported by the kernel, from the oldest kernels to
+// Linux 5.3. They are stored in IPVSHandler.tunnelSupport.
+const (
+	tunnelUnknown int32 = iota
+	tunnelIPIP          // IPIP only, no IPVS_DEST_ATTR_TUN_TYPE
+	tunnelTypes         // IPVS_DEST_ATTR_TUN_TYPE and TUN_PORT, Linux 5.2
+	tunnelFlags         // IPVS_DEST_ATTR_TUN_FLAGS, Linux 5.3
+)
+
+// support returns the tunnel attributes the kernel must know to apply tun.
+// A plain IPIP tunnel works with every kernel.
+func (tun *tunnelConfig) support() int32 {
+	switch {
+	case tun.flags != IP_VS_TUNNEL_ENCAP_FLAG_NOCSUM:
+		return tunnelFlags
+	case tun.tunType != IP_VS_CONN_F_TUNNEL_TYPE_IPIP:
+		return tunnelTypes
+	}
+	return tunnelIPIP
+}
+
+func tunnelSupportError(cmd uint8, si *ServiceEntry, di *DestinationEntry, support int32) *OperationError {
+	missing := "IPVS_DEST_ATTR_TUN_TYPE"
+	if support == tunnelFlags {
+		missing = "IPVS_DEST_ATTR_TUN_FLAGS"
+	}
+	return notSupported(cmd, si, di, fmt.Errorf("kernel does not support %s", missing))
+}
+
+// checkTunnel returns an error matching ErrNotSupported, before anything is
+// sent, if the handler already knows that the kernel ignores the tunnel
+// options of di.
+func (h *IPVSHandler) checkTunnel(cmd uint8, si *ServiceEntry, di *DestinationEntry) error {
+	if !di.hasTunnelOptions() {
+		return nil
+	}
+	tun, err := di.tunnel()
+	if err != nil {
+		return invalidArgument(cmd, si, di, err)
+	}
+	if known := atomic.LoadInt32(&h.tunnelSupport); known != tunnelUnknown && known < tun.support() {
+		return tunnelSupportError(cmd, si, di, tun.support())
+	}
+	return nil
+}
+
+// mustVerifyTunnel reports whether writing di is the first hint of the
+// kernel tunnel support, which then has to be read back by verifyTunnel.
+func (h *IPVSHandler) mustVerifyTunnel(di *DestinationEntry) bool {
+	if !di.hasTunnelOptions() || atomic.LoadInt32(&h.tunnelSupport) != tunnelUnknown {
+		return false
+	}
+	tun, err := di.tunnel()
+	return err == nil && tun.support() > tunnelIPIP
+}
+
+// verifyTunnel reads back the destination di written by cmd, records the
+// tunnel attributes supported by the kernel in the handler and returns an
+// error matching ErrNotSupported if the kernel ignored some of them:
+// kernels without IPVS_DEST_ATTR_TUN_TYPE (added in Linux 5.2) or
+// IPVS_DEST_ATTR_TUN_FLAGS (5.3) silently use a plain IPIP tunnel. A
+// destination added with such a tunnel is deleted again, an updated one is
+// set back to old. Later writes are checked by checkTunnel before they are
+// sent.
+func (h *IPVSHandler) verifyTunnel(ctx context.Context, cmd uint8, si *ServiceEntry, di, old *DestinationEntry) error {
+	want, err := di.tunnel()
+	if err != nil {
+		return err
+	}
+	got, err := h.GetDestinationContext(ctx, si, di.Address, di.Port)
+	if err != nil {
+		oe := newOperationError(cmd, si, di, fmt.Errorf("read back tunnel: %w", err))
+		oe.applied = true
+		return oe
+	}
+
+	support := tunnelFlags
+	switch {
+	case got.TunnelType == "":
+		support = tunnelIPIP
+	case got.TunnelChecksum == "":
+		support = tunnelTypes
+	}
+	atomic.StoreInt32(&h.tunnelSupport, support)
+	if support >= want.support() {
+		return nil
+	}
+
+	oe := tunnelSupportError(cmd, si, di, want.support())
+	switch {
+	case cmd == IPVS_CMD_NEW_DEST:
+		if _, err := h.sendRequest(ctx, IPVS_CMD_DEL_DEST, si, di); err != nil {
+			oe.Message += fmt.Sprintf(", destination left with a plain tunnel: %v", err)
+			oe.applied = true
+		}
+	case old != nil:
+		if _, err := h.sendRequest(ctx, IPVS_CMD_SET_DEST, si, old); err != nil {
+			oe.Message += fmt.Sprintf(", destination left with a plain tunnel: %v", err)
+			oe.applied = true
+		}
+	}
+	return oe
+}
@@ -0,0 +1,60 @@
+package libipvs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDestinationTunnel(t *testing.T) {
+	d := &DestinationEntry{Address: "10.0.0.1", Port: 80, Weight: 1, Method: "TUN"}
+	if err := d.apply([]DestinationOption{WithTunnel("gue", 6080, "remcsum")}); err != nil {
+		t.Fatalf("Failed apply option %s", err)
+	}
+	got := parseDestinationAttr(t, d)
+	if got.TunnelType != "gue" || got.TunnelPort != 6080 || got.TunnelChecksum != "remcsum" {
+		t.Errorf("different tunnel %s:%d:%s", got.TunnelType, got.TunnelPort, got.TunnelChecksum)
+	}
+
+	got = parseDestinationAttr(t, &DestinationEntry{Address: "10.0.0.1", Port: 80, Method: "TUN", TunnelType: "gre", TunnelChecksum: "csum"})
+	if got.TunnelType != "gre" || got.TunnelPort != 0 || got.TunnelChecksum != "csum" {
+		t.Errorf("different tunnel %s:%d:%s", got.TunnelType, got.TunnelPort, got.TunnelChecksum)
+	}
+
+	for _, d := range []*DestinationEntry{
+		{Address: "10.0.0.1", Method: "NAT", TunnelType: "gue", TunnelPort: 6080},
+		{Address: "10.0.0.1", Method: "TUN", TunnelType: "gue"},
+		{Address: "10.0.0.1", Method: "TUN", TunnelType: "ipip", TunnelPort: 6080},
+		{Address: "10.0.0.1", Method: "TUN", TunnelType: "gre", TunnelChecksum: "remcsum"},
+		{Address: "10.0.0.1", Method: "TUN", TunnelType: "vxlan"},
+	} {
+		if _, err := d.Serialize(); err == nil {
+			t.Errorf("Expected serialize error for %+v", d)
+		}
+	}
+}
+
+func TestCheckTunnel(t *testing.T) {
+	s := &ServiceEntry{Address: "10.0.0.1", Protocol: "TCP", Port: 80, SchedName: "rr"}
+	tests := []struct {
+		support int32
+		d       *DestinationEntry
+		ok      bool
+	}{
+		{tunnelUnknown, &DestinationEntry{Address: "10.0.0.2", Method: "TUN", TunnelType: "gre", TunnelChecksum: "csum"}, true},
+		{tunnelIPIP, &DestinationEntry{Address: "10.0.0.2", Method: "TUN", TunnelType: "ipip"}, true},
+		{tunnelIPIP, &DestinationEntry{Address: "10.0.0.2", Method: "TUN", TunnelType: "gue", TunnelPort: 6080}, false},
+		{tunnelTypes, &DestinationEntry{Address: "10.0.0.2", Method: "TUN", TunnelType: "gue", TunnelPort: 6080}, true},
+		{tunnelTypes, &DestinationEntry{Address: "10.0.0.2", Method: "TUN", TunnelType: "gre", TunnelChecksum: "csum"}, false},
+		{tunnelFlags, &DestinationEntry{Address: "10.0.0.2", Method: "TUN", TunnelType: "gre", TunnelChecksum: "csum"}, true},
+	}
+	for i, test := range tests {
+		h := &IPVSHandler{tunnelSupport: test.support}
+		err := h.checkTunnel(IPVS_CMD_SET_DEST, s, test.d)
+		if test.ok && err != nil {
+			t.Errorf("%d: Failed check tunnel %s", i, err)
+		}
+		if !test.ok && !errors.Is(err, ErrNotSupported) {
+			t.Errorf("%d: Expected ErrNotSupported, got %v", i, err)
+		}
+	}
+}